@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SirGFM/midi-go-key/key_events"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// runCheck checks a config file without opening any device,
+// printing every problem and warning found, and what each MIDI event does in each set.
+//
+// Exits with status 1 if the config file has any problem.
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	path := flags.String("config", "./config.txt", "the path to the configuration file (either a text file, or a JSON file ending in .json)")
+	kit := flags.String("kit", "", "(optional) the path to the kit profile, read before the configuration file")
+	middleC := flags.Int("middle-c", 4, "(optional) the octave of middle C (i.e., note 60) in note names, usually either 4 (i.e., 'C4') or 3 (i.e., 'C3')")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s check [-kit kit.txt] [-config config.txt | config.txt]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 1 {
+		*path = flags.Arg(0)
+	} else if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	midi.SetMiddleCOctave(*middleC)
+	report := key_events.CheckConfig(*path, *kit)
+
+	// The table is only written if the config file (and every file it includes) was fully read.
+	showTable := report.HasMappings()
+	for _, problem := range report.Problems {
+		fmt.Printf("error: %s\n", problem)
+		if errors.Is(problem.Err, key_events.ErrOpenConfig) || errors.Is(problem.Err, key_events.ErrReadFile) {
+			showTable = false
+		}
+	}
+	for _, warning := range report.Warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+
+	if showTable {
+		if len(report.Problems) > 0 || len(report.Warnings) > 0 {
+			fmt.Println()
+		}
+		if err := report.WriteTable(os.Stdout); err != nil {
+			panic(fmt.Sprintf("%+v", err))
+		}
+	}
+
+	if len(report.Problems) > 0 {
+		os.Exit(1)
+	}
+}
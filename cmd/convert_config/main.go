@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SirGFM/midi-go-key/key_events"
+)
+
+func main() {
+	output := flag.String("o", "", "(optional) the path to the converted config file, instead of printing it")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-o config.json] config.txt\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := key_events.ConvertConfig(flag.Arg(0))
+	if err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+
+	if *output == "" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(*output, data, 0644); err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+}
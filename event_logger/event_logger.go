@@ -32,6 +32,11 @@ type EventLogger interface {
 	// SendKeyboardEvent queues a keyboard event,
 	// which registers that the given keyboard key(s) was(were) pressed/released.
 	SendKeyboardEvent(keys []string, isPressed bool)
+
+	// SendForcedReleaseEvent queues a forced release event,
+	// which registers that the given keyboard key(s) was(were) automatically released
+	// for being held for too long.
+	SendForcedReleaseEvent(keys []string)
 }
 
 type keyboardEvent struct {
@@ -41,6 +46,11 @@ type keyboardEvent struct {
 	IsPressed bool
 }
 
+type forcedReleaseEvent struct {
+	// The keys that were released by this event.
+	Keys []string
+}
+
 type midiEvent struct {
 	// The MIDI event channel.
 	Channel uint8
@@ -82,6 +92,8 @@ type eventLogger struct {
 	midiPresses map[midiEvent]time.Time
 	// Which keyboard keys are currently pressed.
 	keyPresses map[string]bool
+	// When each keyboard key was last forcefully released.
+	keyForcedReleases map[string]time.Time
 	// Whether there were any updates to the maps.
 	didUpdate bool
 }
@@ -93,6 +105,8 @@ type message struct {
 	MidiPresses map[midiEvent]time.Time `json:"midi"`
 	// Which keyboard keys are currently pressed.
 	KeysPresses map[string]bool `json:"keys"`
+	// When each keyboard key was last forcefully released.
+	KeysForcedReleases map[string]time.Time `json:"forced"`
 }
 
 // New starts a new event logger,
@@ -100,11 +114,12 @@ type message struct {
 // to an endpoint.
 func New(endpoint *string) EventLogger {
 	el := &eventLogger{
-		queue:       make(chan any, queueSize),
-		midiMap:     make(map[midiEvent]string),
-		midiPresses: make(map[midiEvent]time.Time),
-		keyPresses:  make(map[string]bool),
-		timer:       time.NewTicker(cacheTime),
+		queue:             make(chan any, queueSize),
+		midiMap:           make(map[midiEvent]string),
+		midiPresses:       make(map[midiEvent]time.Time),
+		keyPresses:        make(map[string]bool),
+		timer:             time.NewTicker(cacheTime),
+		keyForcedReleases: make(map[string]time.Time),
 	}
 
 	if endpoint != nil && *endpoint != "" {
@@ -151,6 +166,12 @@ func (el *eventLogger) SendKeyboardEvent(keys []string, isPressed bool) {
 	}
 }
 
+func (el *eventLogger) SendForcedReleaseEvent(keys []string) {
+	el.queue <- forcedReleaseEvent{
+		Keys: keys,
+	}
+}
+
 // run is the event logger's mainloop,
 // waiting and handling events.
 func (el *eventLogger) run() {
@@ -179,6 +200,11 @@ func (el *eventLogger) handleEvent(event any) {
 		for _, key := range value.Keys {
 			el.keyPresses[key] = value.IsPressed
 		}
+	case forcedReleaseEvent:
+		now := time.Now()
+		for _, key := range value.Keys {
+			el.keyForcedReleases[key] = now
+		}
 	case midiEvent:
 		el.midiPresses[value] = time.Now()
 	case registerEvent:
@@ -193,9 +219,10 @@ func (el *eventLogger) handleEvent(event any) {
 // queueMessage prepares a message and queue it to be sent to the remote server.
 func (el *eventLogger) queueMessage() {
 	msg := message{
-		MidiMap:     el.midiMap,
-		MidiPresses: el.midiPresses,
-		KeysPresses: el.keyPresses,
+		MidiMap:            el.midiMap,
+		MidiPresses:        el.midiPresses,
+		KeysPresses:        el.keyPresses,
+		KeysForcedReleases: el.keyForcedReleases,
 	}
 
 	data, err := json.Marshal(&msg)
@@ -0,0 +1,165 @@
+package key_events
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The handle used by custom actions (e.g., scripts, plugins and actions registered with RegisterActionType)
+// to interact with the keyboard and the named sets.
+// Every method must be called from the goroutine handling MIDI events
+// (i.e., from the action itself, or from a function queued with After).
+type ActionHandle interface {
+	// PressKeys presses the requested keys, by their keycode.
+	PressKeys(keyCodes []int)
+
+	// ReleaseKeys releases the requested keys, by their keycode,
+	// if they were pressed by this handle.
+	ReleaseKeys(keyCodes []int)
+
+	// TapKeys presses the requested keys, by their keycode,
+	// releasing them after releaseTime.
+	TapKeys(keyCodes []int, releaseTime time.Duration)
+
+	// IsKeyHeld checks whether any action is currently holding the key, by its keycode.
+	IsKeyHeld(keyCode int) bool
+
+	// After calls fn after delay, from the goroutine handling MIDI events.
+	// Functions still queued when the action gets stopped (e.g., when its named set is deactivated)
+	// aren't called.
+	After(delay time.Duration, fn func())
+
+	// UseSet activates the named set.
+	UseSet(name string)
+
+	// IsSetActive checks whether the named set is currently active,
+	// either as the selected set or as a layer on top of it.
+	IsSetActive(name string) bool
+}
+
+// Implements ActionHandle, pressing keys through its own key handlers.
+type actionHandle struct {
+	// The key events generator running the action.
+	kbEv *keyEvents
+	// The key handler of each key pressed through the handle.
+	keys map[int]*keyAction
+	// For how long keys pressed through the handle may be held.
+	maxHold time.Duration
+	// Incremented whenever the action is stopped,
+	// so functions queued before that are ignored.
+	// Must be accessed atomically, since it's also checked by the timers of queued functions.
+	generation int32
+}
+
+// newActionHandle creates a new handle, whose keys may be held for at most kbEv.maxHold.
+// The handle is closed alongside kbEv.
+func (kbEv *keyEvents) newActionHandle() *actionHandle {
+	h := &actionHandle{
+		kbEv:    kbEv,
+		keys:    make(map[int]*keyAction),
+		maxHold: kbEv.maxHold,
+	}
+	kbEv.handles = append(kbEv.handles, h)
+
+	return h
+}
+
+// keyAction returns the key handler used to press keyCode, creating it if needed.
+//
+// Unlike keyEvents.newKeyAction, this may be called while handling events,
+// so the key handler is kept by the handle, instead of being shared with other actions.
+func (h *actionHandle) keyAction(keyCode int) *keyAction {
+	action, ok := h.keys[keyCode]
+	if !ok {
+		kbEv := h.kbEv
+		action = newKeyAction(keyCode, kbEv.keys, kbEv.timedAction, nil, h.maxHold, kbEv.el)
+		h.keys[keyCode] = action
+	}
+
+	return action
+}
+
+func (h *actionHandle) PressKeys(keyCodes []int) {
+	for _, keyCode := range keyCodes {
+		h.keyAction(keyCode).Press()
+	}
+}
+
+func (h *actionHandle) ReleaseKeys(keyCodes []int) {
+	for _, keyCode := range keyCodes {
+		if keyAction, ok := h.keys[keyCode]; ok && keyAction.IsPressed() {
+			keyAction.Release()
+		}
+	}
+}
+
+func (h *actionHandle) TapKeys(keyCodes []int, releaseTime time.Duration) {
+	for _, keyCode := range keyCodes {
+		keyAction := h.keyAction(keyCode)
+		keyAction.Press()
+		keyAction.QueueTimedAction(releaseTime)
+	}
+}
+
+func (h *actionHandle) IsKeyHeld(keyCode int) bool {
+	return h.kbEv.IsKeyHeld(keyCode)
+}
+
+func (h *actionHandle) After(delay time.Duration, fn func()) {
+	generation := atomic.LoadInt32(&h.generation)
+	isCurrent := func() bool {
+		return atomic.LoadInt32(&h.generation) == generation
+	}
+
+	queued := func() {
+		if isCurrent() {
+			fn()
+		}
+	}
+	time.AfterFunc(delay, func() {
+		// Don't queue functions canceled in the meantime (e.g., by a reload),
+		// nor block if the key events generator already stopped.
+		if !isCurrent() {
+			return
+		}
+
+		select {
+		case h.kbEv.timedAction <- queued:
+		case <-h.kbEv.done:
+		}
+	})
+}
+
+func (h *actionHandle) UseSet(name string) {
+	h.kbEv.SetNamedSet(name)
+}
+
+func (h *actionHandle) IsSetActive(name string) bool {
+	return h.kbEv.isSetActive(name)
+}
+
+// releaseKeys releases every key pressed through the handle.
+func (h *actionHandle) releaseKeys() {
+	for _, keyAction := range h.keys {
+		if keyAction.IsPressed() {
+			keyAction.Release()
+		}
+	}
+}
+
+// stop cancels every function queued through the handle and releases every key that it pressed.
+func (h *actionHandle) stop() {
+	atomic.AddInt32(&h.generation, 1)
+	h.releaseKeys()
+}
+
+// Close releases any resources associated with the handle,
+// releasing its keys if they are still pressed.
+func (h *actionHandle) Close() error {
+	atomic.AddInt32(&h.generation, 1)
+	for _, keyAction := range h.keys {
+		keyAction.Close()
+	}
+
+	return nil
+}
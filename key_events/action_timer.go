@@ -0,0 +1,87 @@
+package key_events
+
+import (
+	"sync"
+	"time"
+)
+
+// A timer that queues its action on the main thread whenever it expires.
+type actionTimer struct {
+	// The internal timer.
+	timer *time.Ticker
+	// Synchronizes access to timer.
+	mutex sync.Mutex
+	// The action queued when the timer expires.
+	action timerAction
+	// Queue the action on the main thread.
+	queue chan timerAction
+	// Channel used to signal that the timer should be stopped forever.
+	stop chan struct{}
+}
+
+// newActionTimer creates a new, stopped, actionTimer.
+// Whenever the timer expires, action is sent on queue.
+func newActionTimer(queue chan timerAction, action timerAction) *actionTimer {
+	t := &actionTimer{
+		timer:  time.NewTicker(time.Second),
+		action: action,
+		queue:  queue,
+		stop:   make(chan struct{}),
+	}
+	t.timer.Stop()
+	go t.wait()
+
+	return t
+}
+
+// Reset (re)starts the timer, so it expires after timeout.
+// This function is thread safe!
+func (t *actionTimer) Reset(timeout time.Duration) {
+	t.mutex.Lock()
+	t.timer.Reset(timeout)
+	t.mutex.Unlock()
+}
+
+// Stop pauses the timer.
+// This function is thread safe!
+func (t *actionTimer) Stop() {
+	t.mutex.Lock()
+	t.timer.Stop()
+	t.mutex.Unlock()
+}
+
+// wait blocks until the timer expires, when it queues its action.
+// After the action is queued, the timer is stopped.
+func (t *actionTimer) wait() {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-t.timer.C:
+			// Do nothing and just exits the select.
+		}
+
+		select {
+		case <-t.stop:
+			return
+		case t.queue <- t.action:
+		}
+
+		t.Stop()
+	}
+}
+
+// Close stops the timer forever.
+func (t *actionTimer) Close() error {
+	select {
+	// If the timer was already closed, simply exit.
+	case <-t.stop:
+		return nil
+	default:
+	}
+
+	t.Stop()
+	close(t.stop)
+
+	return nil
+}
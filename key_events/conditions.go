@@ -0,0 +1,87 @@
+package key_events
+
+import (
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// Decides whether an action should handle the MIDI event.
+type Condition func(ev midi.MidiEvent) bool
+
+func (kbEv *keyEvents) SetCondition(cond Condition) {
+	kbEv.condition = cond
+}
+
+func (kbEv *keyEvents) IsKeyHeld(keyCode int) bool {
+	return kbEv.keys.IsHeld(keyCode)
+}
+
+func (kbEv *keyEvents) IsSetActive(name string) bool {
+	return kbEv.isSetActive(name)
+}
+
+func (kbEv *keyEvents) HitWithin(channel, key uint8, windowMs int32, ev midi.MidiEvent) bool {
+	event := generateNoteEvent(midi.EventNoteOn, channel, key)
+
+	timestamp, ok := kbEv.lastHits[event]
+	if !ok {
+		return false
+	}
+
+	elapsed := ev.Timestamp - timestamp
+	return elapsed >= 0 && elapsed <= windowMs
+}
+
+// andConditions combines two conditions, so both must hold.
+// Either condition may be nil, in which case it's ignored.
+func andConditions(first, second Condition) Condition {
+	if first == nil {
+		return second
+	} else if second == nil {
+		return first
+	}
+
+	return func(ev midi.MidiEvent) bool {
+		return first(ev) && second(ev)
+	}
+}
+
+// recordHit stores when the MIDI event was received, if it's a hit (i.e., a Note On),
+// so it may be checked by HitWithin.
+func (kbEv *keyEvents) recordHit(event noteEvent, ev midi.MidiEvent) {
+	if ev.Type == midi.EventNoteOn && ev.Velocity > 0 {
+		kbEv.lastHits[event] = ev.Timestamp
+	}
+}
+
+// guardAction wraps action so it's only executed if cond holds for the MIDI event.
+// Otherwise, fallback is executed instead, unless it's nil.
+func guardAction(cond Condition, action namedMidiAction, fallback *namedMidiAction) namedMidiAction {
+	guarded := namedMidiAction{
+		Action: func(ev midi.MidiEvent) {
+			if cond(ev) {
+				action.Action(ev)
+			} else if fallback != nil {
+				fallback.Action(ev)
+			}
+		},
+		Register: action.Register,
+		Stop:     action.Stop,
+	}
+
+	if fallback != nil {
+		guarded.Register = func() {
+			fallback.Register()
+			action.Register()
+		}
+		guarded.Stop = func() {
+			if fallback.Stop != nil {
+				fallback.Stop()
+			}
+			if action.Stop != nil {
+				action.Stop()
+			}
+		}
+	}
+
+	return guarded
+}
@@ -0,0 +1,72 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestConditionalAction(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiSnare = 2
+	const midiToggle = 3
+	const midiPedal = 4
+	const midiCrash = 5
+	const keyAttack = 6
+	const keyDash = 7
+	const keyDown = 8
+	const keyCrash = 9
+	const releaseTime = 20 * time.Millisecond
+	const windowMs = 50
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyAttack, keyDash, keyDown, keyCrash)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterToggleAction(evType, channel, midiToggle, keyDown, threshold, threshold, releaseTime)
+	ke.RegisterBasicPressAction(evType, channel, midiSnare, keyAttack, threshold, releaseTime)
+
+	ke.SetCondition(func(midi.MidiEvent) bool { return ke.IsKeyHeld(keyDown) })
+	ke.RegisterBasicPressAction(evType, channel, midiSnare, keyDash, threshold, releaseTime)
+
+	ke.SetCondition(func(ev midi.MidiEvent) bool { return ke.HitWithin(channel, midiPedal, windowMs, ev) })
+	ke.RegisterBasicPressAction(evType, channel, midiCrash, keyCrash, threshold, releaseTime)
+	ke.SetCondition(nil)
+
+	// Test that the previous action is used while the condition doesn't hold.
+	assertKeyEvent(t, kc, keyAttack, evType, channel, midiSnare, 100, conn, releaseTime, 10*time.Millisecond)
+
+	// Test that the conditional action is used while the key is held.
+	sendMidiEvent(evType, channel, midiToggle, 100, conn)
+	assertKeyStates(t, kc[keyDown], 10*time.Millisecond, true)
+	assertKeyEvent(t, kc, keyDash, evType, channel, midiSnare, 100, conn, releaseTime, 10*time.Millisecond)
+	assert(t, !kc[keyAttack].state, "the previous action was executed")
+
+	sendMidiEvent(evType, channel, midiToggle, 100, conn)
+	assertKeyStates(t, kc[keyDown], 10*time.Millisecond, false)
+	assertKeyEvent(t, kc, keyAttack, evType, channel, midiSnare, 100, conn, releaseTime, 10*time.Millisecond)
+
+	// Test that the conditional action only fires shortly after the other pad is hit.
+	sendMidiEvent(evType, channel, midiPedal, 100, conn)
+	assertKeyEvent(t, kc, keyCrash, evType, channel, midiCrash, 100, conn, releaseTime, 10*time.Millisecond)
+
+	time.Sleep(windowMs * time.Millisecond)
+	sendMidiEvent(evType, channel, midiCrash, 100, conn)
+	select {
+	case <-kc[keyCrash].newState:
+		t.Fatalf("the conditional action was executed after its window")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -3,8 +3,8 @@ package key_events
 import (
 	"bufio"
 	"errors"
-	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -20,13 +20,46 @@ var actionsToArgCount = map[string]int{
 	"TOGGLE":          2,
 	"REPEAT":          2,
 	"REPEAT-SEQUENCE": 6,
+	"DIAGONAL":        5,
 	"USE-MAPPING":     1,
 	"NEW-MAPPING":     1,
+	"EXEC":            3,
+	"EXEC-SHELL":      3,
+	"WEBHOOK":         2,
+	"TURBO":           2,
+	"HOLD-MAPPING":    1,
+	"SELECT-MAPPING":  1,
+	"PREV-MAPPING":    1,
+	"LAST-MAPPING":    0,
+	"NEW-LAYER":       1,
+	"ON-ENTER":        1,
+	"ON-EXIT":         1,
+	"PANIC":           0,
+	"SOCD":            1,
+	"VAR":             1,
+	"VAR-SET":         1,
+	"VAR-INC":         1,
+	"VAR-DEC":         1,
+	"VAR-KEY":         2,
+	"SCRIPT":          1,
+	"PLUGIN":          1,
+	"PLUGIN-EVENT":    1,
+}
+
+// List the actions that may be bound to Control Change events (i.e., "cc=").
+var actionsAcceptingControlChange = map[string]bool{
+	"HOLD-MAPPING": true,
 }
 
 // The minimum number of arguments in a line.
 const minArgs = 5
 
+// List the options that may be set on a mapping, between the threshold and the action.
+var mappingOptions = []string{
+	"hold=",
+	"if=",
+}
+
 // getInt reads an integer from arg, removing the prefix from the start.
 // badTokeErr is returned if the prefix is invalid, and invalidErr
 // if the value isn't an integer.
@@ -48,18 +81,200 @@ func getInt(arg, prefix string, badTokenErr, invalidErr error) (int, error) {
 	return int(val), nil
 }
 
+// getEvent parses the key of an event of type evType, after prefix.
+// Notes may also be named (e.g., "ev=C#2" or "ev=acoustic-snare").
+func getEvent(arg, prefix string, evType midi.MidiEventType) (int, error) {
+	val, err := getInt(arg, prefix, ErrConfigEventTokenMissing, ErrConfigEventInvalid)
+	if errors.Is(err, ErrConfigEventInvalid) && evType == midi.EventNoteOn {
+		if note, ok := midi.ParseNote(arg[len(prefix):]); ok {
+			return int(note), nil
+		}
+	}
+
+	return val, err
+}
+
+// isMappingOption checks whether arg is one of the options in mappingOptions.
+func isMappingOption(arg string) bool {
+	for _, option := range mappingOptions {
+		if strings.HasPrefix(arg, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCondition parses a mapping's condition, which may be one of:
+//   - "held:KEY": the key is being held by some action;
+//   - "set:NAME": the named set is active;
+//   - "hit:EV:MS": the Note On event EV, in channel, was hit within MS milliseconds
+//     (EV may be named, exactly like "ev=");
+//   - "var:NAME:VALUE": the named variable is set to VALUE.
+//
+// Conditions may be negated by starting them with '!'.
+func (kbEv *keyEvents) parseCondition(channel uint8, spec string) (Condition, error) {
+	negate := strings.HasPrefix(spec, "!")
+	parts := strings.Split(strings.TrimPrefix(spec, "!"), ":")
+
+	var cond Condition
+	switch {
+	case parts[0] == "held" && len(parts) == 2:
+		keyCode, ok := keyNameToInt[strings.ToUpper(parts[1])]
+		if !ok || keyCode == -1 {
+			return nil, ErrConfigKeyInvalid
+		}
+
+		cond = func(midi.MidiEvent) bool { return kbEv.IsKeyHeld(keyCode) }
+	case parts[0] == "set" && len(parts) == 2 && parts[1] != "":
+		name := parts[1]
+
+		cond = func(midi.MidiEvent) bool { return kbEv.IsSetActive(name) }
+	case parts[0] == "hit" && len(parts) == 3:
+		key, err := getEvent(parts[1], "", midi.EventNoteOn)
+		if err != nil {
+			return nil, err_wrap.Wrap(err, ErrConfigOptionInvalid)
+		} else if key < 0 || key > 255 {
+			return nil, ErrConfigOptionInvalid
+		}
+		windowMs, err := strconv.ParseUint(parts[2], 0, 31)
+		if err != nil {
+			return nil, err_wrap.Wrap(err, ErrConfigOptionInvalid)
+		}
+
+		cond = func(ev midi.MidiEvent) bool {
+			return kbEv.HitWithin(channel, uint8(key), int32(windowMs), ev)
+		}
+	case parts[0] == "var" && len(parts) == 3:
+		name := parts[1]
+		if _, ok := kbEv.variables[name]; !ok {
+			return nil, ErrConfigVariableUnknown
+		}
+		want, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return nil, err_wrap.Wrap(err, ErrConfigOptionInvalid)
+		}
+
+		cond = func(midi.MidiEvent) bool {
+			value, _ := kbEv.Variable(name)
+			return value == want
+		}
+	default:
+		return nil, ErrConfigOptionInvalid
+	}
+
+	if negate {
+		inner := cond
+		cond = func(ev midi.MidiEvent) bool { return !inner(ev) }
+	}
+
+	return cond, nil
+}
+
+// The state kept while reading a config file.
+type configState struct {
+	// The initially active named set.
+	initialSet string
+	// Every problem found so far.
+	problems []ConfigProblem
+	// Every mapping read so far.
+	mappings []configMapping
+	// The files being read, starting with the file that included every other one.
+	files []string
+	// The value of each constant defined so far.
+	defines map[string]string
+
+	// Where the line being parsed is: its file, its line number,
+	// and its mapping (for JSON config files).
+	file    string
+	line    int
+	mapping string
+
+	// The global settings, which each line may override,
+	// and which are restored before parsing every line.
+	maxHold       time.Duration
+	appendActions bool
+	condition     Condition
+}
+
+// newConfigState saves the global settings that may be overridden by the lines of a config file.
+func (kbEv *keyEvents) newConfigState() *configState {
+	return &configState{
+		maxHold:       kbEv.maxHold,
+		appendActions: kbEv.appendActions,
+		condition:     kbEv.condition,
+	}
+}
+
+// report records that the line being parsed has a problem.
+func (state *configState) report(err error) {
+	state.problems = append(state.problems, configProblems(state.file, state.line, state.mapping, err)...)
+}
+
+// err returns every problem found in the config file, if any.
+func (state *configState) err() error {
+	if len(state.problems) == 0 {
+		return nil
+	}
+
+	return &ConfigError{Problems: state.problems}
+}
+
+// restoreConfigState restores the global settings saved in state.
+func (kbEv *keyEvents) restoreConfigState(state *configState) {
+	kbEv.SetMaxHold(state.maxHold)
+	kbEv.SetAppendActions(state.appendActions)
+	kbEv.SetCondition(state.condition)
+	kbEv.location = ""
+}
+
 func (kbEv *keyEvents) ReadConfig(path string) error {
+	state := kbEv.newConfigState()
+	defer kbEv.restoreConfigState(state)
+
+	kbEv.readConfig(state, path)
+	kbEv.SetNamedSet(state.initialSet)
+
+	return state.err()
+}
+
+// readConfig reads the kit profile (if any) and then the config file in path,
+// recording every problem in state.
+// Lines with problems are skipped, but the rest of the file is still read,
+// so every problem is reported at once.
+//
+// The initial named set isn't activated, so reading the config never presses any key.
+func (kbEv *keyEvents) readConfig(state *configState, path string) {
+	if kbEv.kitProfile != "" {
+		kbEv.readConfigFile(state, kbEv.kitProfile)
+	}
+	kbEv.readConfigFile(state, path)
+}
+
+// readConfigFile reads the config file in path (and every file included by it),
+// recording every problem in state.
+func (kbEv *keyEvents) readConfigFile(state *configState, path string) {
+	// Track the files being read, so files can't include themselves.
+	state.files = append(state.files, absPath(path))
+	defer func() {
+		state.files = state.files[:len(state.files)-1]
+	}()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		kbEv.readJSONConfig(state, path)
+		return
+	}
+
+	state.file, state.line, state.mapping = path, 0, ""
+
 	file, err := os.Open(path)
 	if err != nil {
-		return err_wrap.Wrap(err, ErrOpenConfig)
+		state.report(err_wrap.Wrap(err, ErrOpenConfig))
+		return
 	}
 	defer file.Close()
 
-	// The initially active named set.
-	var initialSet string
-
 	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	for lineNum := 1; scanner.Scan(); lineNum++ {
 		line := scanner.Text()
 
 		// Skip empty lines and lines starting on # (i.e., comments).
@@ -67,189 +282,676 @@ func (kbEv *keyEvents) ReadConfig(path string) error {
 			continue
 		}
 
-		// Break each line into space-separated components.
-		args := strings.Split(line, " ")
-		if len(args) < minArgs {
-			return ErrConfigArgsBad
-		}
+		state.line = lineNum
+		kbEv.location = path + ":" + strconv.Itoa(lineNum)
 
-		// Parse the arguments
-		intCh, err := getInt(args[0], "ch=", ErrConfigChannelTokenMissing, ErrConfigChannelTokenInvalid)
+		var err error
+		if include, ok := includedPath(line); ok {
+			err = kbEv.includeConfig(state, path, include)
+		} else if spec, ok := definition(line); ok {
+			err = state.define(spec)
+		} else {
+			err = kbEv.parseLine(state, path, line)
+		}
 		if err != nil {
-			return err
-		} else if intCh < 0 || intCh > 15 {
-			return ErrConfigChannelTokenInvalid
+			state.report(err)
 		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		state.line = 0
+		state.report(err_wrap.Wrap(err, ErrReadFile))
+	}
+}
+
+// parseLine parses a single line of the config file in path,
+// registering its action.
+func (kbEv *keyEvents) parseLine(state *configState, path, line string) error {
+	// Lines starting on + add their action to the event, instead of replacing it.
+	kbEv.SetAppendActions(state.appendActions)
+	if line[0] == '+' {
+		kbEv.SetAppendActions(true)
+		line = line[1:]
+	}
+
+	// Break each line into space-separated components.
+	args := strings.Split(line, " ")
+	state.expand(args)
+	if len(args) < minArgs {
+		return badToken(line, ErrConfigArgsBad)
+	}
+
+	// Parse the arguments, checking every one of them
+	// so every problem in the line is reported at once.
+	var errs lineErrors
+
+	intCh, err := getInt(args[0], "ch=", ErrConfigChannelTokenMissing, ErrConfigChannelTokenInvalid)
+	if err != nil {
+		errs = append(errs, badToken(args[0], err))
+	} else if intCh < 0 || intCh > 15 {
+		errs = append(errs, badToken(args[0], ErrConfigChannelTokenInvalid))
+	}
 
-		intEv, err := getInt(args[1], "ev=", ErrConfigEventTokenMissing, ErrConfigEventInvalid)
+	// Events default to Note On, but Control Changes may be used instead.
+	evType := midi.EventNoteOn
+	evToken := "ev="
+	if strings.HasPrefix(args[1], "cc=") {
+		evType = midi.EventControlChange
+		evToken = "cc="
+	}
+
+	intEv, err := getEvent(args[1], evToken, evType)
+	if err != nil {
+		errs = append(errs, badToken(args[1], err))
+	} else if intEv < 0 || intEv > 255 {
+		errs = append(errs, badToken(args[1], ErrConfigEventInvalid))
+	}
+
+	var key int
+	if !strings.HasPrefix(args[2], "key=") {
+		errs = append(errs, badToken(args[2], ErrConfigKeyTokenMissing))
+	} else if keyCode, ok := keyNameToInt[strings.ToUpper(args[2][len("key="):])]; !ok {
+		errs = append(errs, badToken(args[2], ErrConfigKeyInvalid))
+	} else {
+		key = keyCode
+	}
+
+	intThres, err := getInt(args[3], "thres=", ErrConfigThresholdTokenMissing, ErrConfigThresholdInvalid)
+	if err != nil {
+		errs = append(errs, badToken(args[3], err))
+	} else if intThres < 0 || intThres > 255 {
+		errs = append(errs, badToken(args[3], ErrConfigThresholdInvalid))
+	}
+
+	// Parse the mapping's options, removing them from the arguments.
+	kbEv.SetMaxHold(state.maxHold)
+	kbEv.SetCondition(state.condition)
+	var conditions []string
+	for len(args) > minArgs-1 && isMappingOption(args[minArgs-1]) {
+		option := args[minArgs-1]
+		args = append(args[:minArgs-1], args[minArgs:]...)
+
+		switch {
+		case strings.HasPrefix(option, "hold="):
+			ms, err := strconv.ParseUint(option[len("hold="):], 0, 32)
+			if err != nil {
+				errs = append(errs, badToken(option, err_wrap.Wrap(err, ErrConfigOptionInvalid)))
+				continue
+			}
+			kbEv.SetMaxHold(time.Duration(ms) * time.Millisecond)
+		case strings.HasPrefix(option, "if="):
+			cond, err := kbEv.parseCondition(uint8(intCh), option[len("if="):])
+			if err != nil {
+				errs = append(errs, badToken(option, err))
+				continue
+			}
+			kbEv.SetCondition(andConditions(kbEv.condition, cond))
+			conditions = append(conditions, option[len("if="):])
+		}
+	}
+	if len(args) < minArgs {
+		return append(errs, ErrConfigArgsBad)
+	}
+
+	// Check that there are enough arguments for the action.
+	action := args[4]
+	wantArgs, ok := actionsToArgCount[action]
+	customType, isCustom := lookupActionType(action)
+	if isCustom {
+		// Custom actions receive the event's type, so they may handle Control Changes by themselves.
+		wantArgs = len(customType.args)
+	} else if !ok {
+		return append(errs, badToken(action, ErrConfigActionInvalid))
+	} else if evType == midi.EventControlChange && !actionsAcceptingControlChange[action] {
+		errs = append(errs, badToken(args[1], ErrConfigControlChangeInvalid))
+	}
+
+	// Let the last argument, if it's a string, extend to the end of the line.
+	if last := wantArgs + minArgs - 1; len(args) > last+1 && strings.HasPrefix(args[last], "str=") {
+		args = append(args[:last], strings.Join(args[last:], " "))
+	}
+	if len(args) != wantArgs+minArgs {
+		return append(errs, badToken(action, ErrConfigArgsBad))
+	}
+
+	// Parse every argument as a simple non-zero integer.
+	var numArgs []int
+	for _, arg := range args[minArgs:] {
+		num, err := getInt(arg, "", nil, ErrConfigActionArgumentInvalid)
+		if errors.Is(err, ErrConfigIgnored) {
+			// Simply ignore errors if the value was ignored.
+		} else if err != nil {
+			errs = append(errs, badToken(arg, err))
+		} else if num <= 0 {
+			errs = append(errs, badToken(arg, ErrConfigActionArgumentInvalid))
+		}
+
+		numArgs = append(numArgs, num)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	ch := uint8(intCh)
+	ev := uint8(intEv)
+	threshold := uint8(intThres)
+	// The last argument, used to report problems in string arguments.
+	lastArg := args[len(args)-1]
+
+	switch action {
+	case "BASIC":
+		releaseTime := time.Duration(numArgs[0]) * time.Millisecond
+
+		kbEv.RegisterBasicPressAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			key,
+			threshold,
+			releaseTime,
+		)
+	case "VELOCITY":
+		minPress := time.Duration(numArgs[0]) * time.Millisecond
+		maxPress := time.Duration(numArgs[1]) * time.Millisecond
+
+		kbEv.RegisterVelocityAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			key,
+			threshold,
+			minPress,
+			maxPress,
+		)
+	case "TOGGLE":
+		if numArgs[0] > 128 {
+			return badToken(args[minArgs], ErrConfigActionArgumentInvalid)
+		}
+		acceptThreshold := threshold
+		threshold := uint8(numArgs[0])
+		quickPressDuration := time.Duration(numArgs[1]) * time.Millisecond
+
+		kbEv.RegisterToggleAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			key,
+			acceptThreshold,
+			threshold,
+			quickPressDuration,
+		)
+	case "REPEAT":
+		maxRepeatDelayMs := int32(numArgs[0])
+		shortRelease := time.Duration(numArgs[1]) * time.Millisecond
+
+		kbEv.RegisterHoldAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			key,
+			threshold,
+			maxRepeatDelayMs,
+			shortRelease,
+		)
+	case "REPEAT-SEQUENCE":
+		maxRepeatDelayMs := int32(numArgs[0])
+		shortRelease := time.Duration(numArgs[1]) * time.Millisecond
+		backwardEv := uint8(numArgs[2])
+		forwardEv := uint8(numArgs[3])
+		resetEv := uint8(numArgs[4])
+
+		keySequence := [][]int{[]int{key}}
+		sequence := strings.TrimPrefix(lastArg, "str=")
+		for _, keys := range strings.Split(sequence, ";") {
+			newSequence, err := parseKeyNames(strings.Split(keys, ","))
+			if err != nil {
+				errs = append(errs, err.(lineErrors)...)
+			}
+			keySequence = append(keySequence, newSequence)
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+
+		kbEv.RegisterSequenceHoldAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			keySequence,
+			threshold,
+			maxRepeatDelayMs,
+			shortRelease,
+			backwardEv,
+			forwardEv,
+			resetEv,
+		)
+	case "DIAGONAL":
+		otherEv := uint8(numArgs[0])
+		windowMs := int32(numArgs[1])
+		maxRepeatDelayMs := int32(numArgs[2])
+		shortRelease := time.Duration(numArgs[3]) * time.Millisecond
+
+		names := strings.TrimPrefix(lastArg, "str=")
+		otherKeyCodes, err := parseKeyNames(strings.Split(names, ","))
 		if err != nil {
 			return err
-		} else if intEv < 0 || intEv > 255 {
-			return ErrConfigEventInvalid
 		}
+		keyCodes := append([]int{key}, otherKeyCodes...)
+		if len(keyCodes) > 4 {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
+
+		kbEv.RegisterDiagonalAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			otherEv,
+			keyCodes,
+			threshold,
+			windowMs,
+			maxRepeatDelayMs,
+			shortRelease,
+		)
+	case "USE-MAPPING":
+		sequence := strings.TrimPrefix(lastArg, "str=")
+		mappings := strings.Split(sequence, ",")
+
+		kbEv.RegisterMapSwap(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			mappings,
+		)
+
+		state.initialSet = mappings[0]
+	case "NEW-MAPPING":
+		name := strings.TrimPrefix(lastArg, "str=")
+		kbEv.RegisterNamedSet(name)
+	case "NEW-LAYER":
+		// The layer is described as "NAME[,MODE]",
+		// where the mode defaults to TRANSPARENT.
+		layer := strings.Split(strings.TrimPrefix(lastArg, "str="), ",")
+
+		var opaque bool
+		if len(layer) > 2 {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		} else if len(layer) == 2 {
+			switch strings.ToUpper(layer[1]) {
+			case "TRANSPARENT":
+				opaque = false
+			case "OPAQUE":
+				opaque = true
+			default:
+				return badToken(lastArg, ErrConfigActionArgumentInvalid)
+			}
+		}
+
+		kbEv.RegisterNamedLayer(layer[0], opaque)
+	case "SOCD":
+		// The group is described as "KEY,KEY[,...][,MODE]",
+		// where the mode defaults to LAST.
+		names := strings.Split(strings.TrimPrefix(lastArg, "str="), ",")
 
-		if !strings.HasPrefix(args[2], "key=") {
-			return ErrConfigKeyTokenMissing
+		mode := SOCDLastWins
+		if value, ok := socdModeNames[strings.ToUpper(names[len(names)-1])]; ok {
+			mode = value
+			names = names[:len(names)-1]
 		}
-		strKey := args[2][len("key="):]
-		key, ok := keyNameToInt[strings.ToUpper(strKey)]
-		if !ok {
-			return ErrConfigKeyInvalid
+		if len(names) < 2 {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
 		}
 
-		intThres, err := getInt(args[3], "thres=", ErrConfigThresholdTokenMissing, ErrConfigThresholdInvalid)
+		keyCodes, err := parseKeyNames(names)
 		if err != nil {
 			return err
-		} else if intThres < 0 || intThres > 255 {
-			return ErrConfigThresholdInvalid
+		}
+		for i, keyCode := range keyCodes {
+			if keyCode == -1 {
+				errs = append(errs, badToken(names[i], ErrConfigKeyInvalid))
+			}
+		}
+		if len(errs) > 0 {
+			return errs
 		}
 
-		// Check that there are enough arguments for the action.
-		action := args[4]
-		wantArgs, ok := actionsToArgCount[action]
-		if !ok {
-			return ErrConfigActionInvalid
-		} else if len(args) != wantArgs+minArgs {
-			return ErrConfigArgsBad
-		}
-
-		// Parse every argument as a simple non-zero integer.
-		var numArgs []int
-		for _, arg := range args[minArgs:] {
-			num, err := getInt(arg, "", nil, ErrConfigActionArgumentInvalid)
-			if errors.Is(err, ErrConfigIgnored) {
-				// Simply ignore errors if the value was ignored.
-			} else if err != nil {
-				return err
-			} else if num <= 0 {
-				return ErrConfigActionArgumentInvalid
+		kbEv.RegisterSOCDGroup(mode, keyCodes...)
+	case "VAR":
+		// The variable is described as "NAME,MIN,MAX".
+		params := strings.Split(strings.TrimPrefix(lastArg, "str="), ",")
+		if len(params) != 3 || params[0] == "" {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
+		min, err := strconv.Atoi(params[1])
+		if err != nil {
+			return badToken(lastArg, err_wrap.Wrap(err, ErrConfigActionArgumentInvalid))
+		}
+		max, err := strconv.Atoi(params[2])
+		if err != nil {
+			return badToken(lastArg, err_wrap.Wrap(err, ErrConfigActionArgumentInvalid))
+		} else if min > max {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
+
+		kbEv.RegisterVariable(params[0], min, max)
+	case "VAR-SET", "VAR-INC", "VAR-DEC":
+		// The action is described as "NAME,VALUE" for VAR-SET,
+		// and as "NAME[,WRAP]" otherwise.
+		params := strings.Split(strings.TrimPrefix(lastArg, "str="), ",")
+		if _, ok := kbEv.variables[params[0]]; !ok {
+			return badToken(params[0], ErrConfigVariableUnknown)
+		}
+
+		op := VariableInc
+		value := 1
+		var wrap bool
+		if action == "VAR-SET" {
+			if len(params) != 2 {
+				return badToken(lastArg, ErrConfigActionArgumentInvalid)
+			}
+			op = VariableSet
+			value, err = strconv.Atoi(params[1])
+			if err != nil {
+				return badToken(lastArg, err_wrap.Wrap(err, ErrConfigActionArgumentInvalid))
 			}
+		} else {
+			if action == "VAR-DEC" {
+				op = VariableDec
+			}
+			if len(params) > 2 || (len(params) == 2 && strings.ToUpper(params[1]) != "WRAP") {
+				return badToken(lastArg, ErrConfigActionArgumentInvalid)
+			}
+			wrap = len(params) == 2
+		}
+
+		kbEv.RegisterVariableAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			params[0],
+			op,
+			value,
+			wrap,
+		)
+	case "VAR-KEY":
+		releaseTime := time.Duration(numArgs[0]) * time.Millisecond
+
+		// The keys are described as "NAME:KEYS;KEYS;...",
+		// where each KEYS may list multiple keys separated by commas.
+		params := strings.SplitN(strings.TrimPrefix(lastArg, "str="), ":", 2)
+		if len(params) != 2 {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		} else if _, ok := kbEv.variables[params[0]]; !ok {
+			return badToken(params[0], ErrConfigVariableUnknown)
+		}
 
-			numArgs = append(numArgs, num)
-		}
-		if len(numArgs) != wantArgs {
-			return ErrConfigArgsBad
-		}
-
-		ch := uint8(intCh)
-		ev := uint8(intEv)
-		threshold := uint8(intThres)
-
-		switch action {
-		case "BASIC":
-			releaseTime := time.Duration(numArgs[0]) * time.Millisecond
-
-			kbEv.RegisterBasicPressAction(
-				midi.EventNoteOn,
-				ch,
-				ev,
-				key,
-				threshold,
-				releaseTime,
-			)
-		case "VELOCITY":
-			minPress := time.Duration(numArgs[0]) * time.Millisecond
-			maxPress := time.Duration(numArgs[1]) * time.Millisecond
-
-			kbEv.RegisterVelocityAction(
-				midi.EventNoteOn,
-				ch,
-				ev,
-				key,
-				threshold,
-				minPress,
-				maxPress,
-			)
-		case "TOGGLE":
-			if numArgs[0] > 128 {
-				return ErrConfigActionArgumentInvalid
+		var keyCodes [][]int
+		for _, keys := range strings.Split(params[1], ";") {
+			newKeys, err := parseKeyNames(strings.Split(keys, ","))
+			if err != nil {
+				errs = append(errs, err.(lineErrors)...)
+			} else if len(newKeys) > 4 {
+				errs = append(errs, badToken(keys, ErrConfigActionArgumentInvalid))
 			}
-			acceptThreshold := threshold
-			threshold := uint8(numArgs[0])
-			quickPressDuration := time.Duration(numArgs[1]) * time.Millisecond
-
-			kbEv.RegisterToggleAction(
-				midi.EventNoteOn,
-				ch,
-				ev,
-				key,
-				acceptThreshold,
-				threshold,
-				quickPressDuration,
-			)
-		case "REPEAT":
-			maxRepeatDelayMs := int32(numArgs[0])
-			shortRelease := time.Duration(numArgs[1]) * time.Millisecond
-
-			kbEv.RegisterHoldAction(
-				midi.EventNoteOn,
-				ch,
-				ev,
-				key,
-				threshold,
-				maxRepeatDelayMs,
-				shortRelease,
-			)
-		case "REPEAT-SEQUENCE":
-			maxRepeatDelayMs := int32(numArgs[0])
-			shortRelease := time.Duration(numArgs[1]) * time.Millisecond
-			backwardEv := uint8(numArgs[2])
-			forwardEv := uint8(numArgs[3])
-			resetEv := uint8(numArgs[4])
-
-			keySequence := [][]int{[]int{key}}
-			sequence := strings.TrimPrefix(args[len(args)-1], "str=")
-			for _, keys := range strings.Split(sequence, ";") {
-				var newSequence []int
-				for _, name := range strings.Split(keys, ",") {
-					key, ok := keyNameToInt[strings.ToUpper(name)]
-					if !ok {
-						log.Printf("invalid key: '%s'", name)
-						return ErrConfigKeyInvalid
-					}
-					newSequence = append(newSequence, key)
-				}
-				keySequence = append(keySequence, newSequence)
+			keyCodes = append(keyCodes, newKeys)
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+
+		kbEv.RegisterVariableKeyAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			params[0],
+			keyCodes,
+			threshold,
+			releaseTime,
+		)
+	case "SCRIPT":
+		// The function is described as "FILE:FUNCTION",
+		// where the file is relative to the config file.
+		params := strings.Split(strings.TrimPrefix(lastArg, "str="), ":")
+		if len(params) != 2 || params[0] == "" {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
+		scriptPath := params[0]
+		if !filepath.IsAbs(scriptPath) {
+			scriptPath = filepath.Join(filepath.Dir(path), scriptPath)
+		}
+
+		program, err := kbEv.loadScript(scriptPath)
+		if err != nil {
+			return badToken(params[0], err)
+		} else if !program.HasFunction(params[1]) {
+			return badToken(params[1], ErrConfigScriptInvalid)
+		}
+
+		kbEv.RegisterScriptAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			program,
+			params[1],
+		)
+	case "PLUGIN":
+		// The plugin is described as "NAME COMMAND",
+		// where the command (and its arguments) extends until the end of the line.
+		command := strings.Fields(strings.TrimPrefix(lastArg, "str="))
+		if len(command) < 2 {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
+
+		kbEv.RegisterPlugin(command[0], command[1:])
+	case "PLUGIN-EVENT":
+		name := strings.TrimPrefix(lastArg, "str=")
+		if _, ok := kbEv.plugins[name]; !ok {
+			return badToken(name, ErrConfigPluginUnknown)
+		}
+
+		kbEv.RegisterPluginAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			name,
+		)
+	case "PANIC":
+		kbEv.RegisterPanicAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+		)
+	case "ON-ENTER", "ON-EXIT":
+		if kbEv.curSet == "" {
+			return badToken(action, ErrConfigSetActionOutsideSet)
+		}
+		releaseTime := time.Duration(numArgs[0]) * time.Millisecond
+
+		if action == "ON-ENTER" {
+			kbEv.RegisterSetEnterAction(key, releaseTime)
+		} else {
+			kbEv.RegisterSetExitAction(key, releaseTime)
+		}
+	case "PREV-MAPPING":
+		sequence := strings.TrimPrefix(lastArg, "str=")
+		mappings := strings.Split(sequence, ",")
+
+		kbEv.RegisterMapSwapBack(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			mappings,
+		)
+	case "SELECT-MAPPING":
+		name := strings.TrimPrefix(lastArg, "str=")
+
+		kbEv.RegisterMapSelect(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			name,
+		)
+	case "LAST-MAPPING":
+		kbEv.RegisterMapReturn(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+		)
+	case "HOLD-MAPPING":
+		name := strings.TrimPrefix(lastArg, "str=")
+
+		kbEv.RegisterMomentaryMapping(
+			evType,
+			ch,
+			ev,
+			threshold,
+			name,
+		)
+	case "EXEC", "EXEC-SHELL":
+		timeout := time.Duration(numArgs[0]) * time.Millisecond
+		maxRunning := numArgs[1]
+		// Shell commands are passed to the shell exactly as written,
+		// while other commands are split into their (possibly quoted) arguments.
+		line := strings.TrimPrefix(lastArg, "str=")
+		command := []string{line}
+		if action == "EXEC" {
+			var ok bool
+			if command, ok = splitCommand(line); !ok {
+				return badToken(lastArg, ErrConfigActionArgumentInvalid)
 			}
+		}
+		if len(command) == 0 || strings.TrimSpace(line) == "" {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
 
-			kbEv.RegisterSequenceHoldAction(
-				midi.EventNoteOn,
-				ch,
-				ev,
-				keySequence,
-				threshold,
-				maxRepeatDelayMs,
-				shortRelease,
-				backwardEv,
-				forwardEv,
-				resetEv,
-			)
-		case "USE-MAPPING":
-			sequence := strings.TrimPrefix(args[len(args)-1], "str=")
-			mappings := strings.Split(sequence, ",")
-
-			kbEv.RegisterMapSwap(
-				midi.EventNoteOn,
-				ch,
-				ev,
-				threshold,
-				mappings,
-			)
-
-			initialSet = mappings[0]
-		case "NEW-MAPPING":
-			name := strings.TrimPrefix(args[len(args)-1], "str=")
-			kbEv.RegisterNamedSet(name)
-		default:
-			return ErrConfigActionInvalid
+		err := kbEv.RegisterExecAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			timeout,
+			maxRunning,
+			action == "EXEC-SHELL",
+			command,
+		)
+		if err != nil {
+			return badToken(lastArg, err)
+		}
+	case "TURBO":
+		minPeriod := time.Duration(numArgs[0]) * time.Millisecond
+		maxPeriod := time.Duration(numArgs[1]) * time.Millisecond
+		if minPeriod > maxPeriod {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return err_wrap.Wrap(err, ErrReadFile)
+		kbEv.RegisterTurboAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			key,
+			threshold,
+			minPeriod,
+			maxPeriod,
+		)
+	case "WEBHOOK":
+		timeout := time.Duration(numArgs[0]) * time.Millisecond
+
+		// The request is described as "METHOD URL BODY",
+		// where the body may be omitted.
+		request := strings.SplitN(strings.TrimPrefix(lastArg, "str="), " ", 3)
+		if len(request) < 2 {
+			return badToken(lastArg, ErrConfigActionArgumentInvalid)
+		}
+		method := strings.ToUpper(request[0])
+		url := request[1]
+		var body string
+		if len(request) > 2 {
+			body = request[2]
+		}
+
+		err := kbEv.RegisterWebhookAction(
+			midi.EventNoteOn,
+			ch,
+			ev,
+			threshold,
+			timeout,
+			method,
+			url,
+			body,
+		)
+		if err != nil {
+			return badToken(lastArg, err_wrap.Wrap(err, ErrConfigActionArgumentInvalid))
+		}
+	default:
+		if !isCustom {
+			return badToken(action, ErrConfigActionInvalid)
+		}
+
+		ints, strs, err := customType.parseArgs(args[minArgs:], numArgs)
+		if err != nil {
+			return badToken(action, err)
+		}
+
+		err = kbEv.registerCustomAction(action, customType, ActionArgs{
+			EvType:    evType,
+			Channel:   ch,
+			Key:       ev,
+			KeyCode:   key,
+			Threshold: threshold,
+			Ints:      ints,
+			Strings:   strs,
+		})
+		if err != nil {
+			return badToken(action, err_wrap.Wrap(err, ErrConfigActionArgumentInvalid))
+		}
 	}
 
-	kbEv.SetNamedSet(initialSet)
+	var strArgs []string
+	for _, arg := range args[minArgs:] {
+		strArgs = append(strArgs, strings.TrimPrefix(arg, "str="))
+	}
+	state.mappings = append(state.mappings, configMapping{
+		file:       state.file,
+		line:       state.line,
+		mapping:    state.mapping,
+		set:        kbEv.curSet,
+		evType:     evType,
+		channel:    ch,
+		key:        ev,
+		keyName:    args[2][len("key="):],
+		threshold:  threshold,
+		action:     action,
+		args:       strArgs,
+		appended:   kbEv.appendActions,
+		conditions: conditions,
+	})
 
 	return nil
 }
+
+// parseKeyNames converts every key name into its keycode,
+// reporting every invalid name at once.
+func parseKeyNames(names []string) ([]int, error) {
+	var keyCodes []int
+	var errs lineErrors
+	for _, name := range names {
+		keyCode, ok := keyNameToInt[strings.ToUpper(name)]
+		if !ok {
+			errs = append(errs, badToken(name, ErrConfigKeyInvalid))
+			continue
+		}
+		keyCodes = append(keyCodes, keyCode)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return keyCodes, nil
+}
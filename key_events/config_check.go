@@ -0,0 +1,359 @@
+package key_events
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// A mapping read from a config file, kept so the config may be checked.
+type configMapping struct {
+	// Where the mapping was defined.
+	file    string
+	line    int
+	mapping string
+	// The named set receiving the mapping, or an empty string for the default set.
+	set string
+	// The MIDI event triggering the mapping.
+	evType  midi.MidiEventType
+	channel uint8
+	key     uint8
+	// The keyboard key, as written in the config.
+	keyName   string
+	threshold uint8
+	action    string
+	// The action's arguments, without their "str=" prefix.
+	args []string
+	// Whether the action was added to the event's other actions (i.e., the line started with '+').
+	appended bool
+	// Every "if=" condition, without its prefix.
+	conditions []string
+}
+
+// location describes where the mapping was defined.
+func (m *configMapping) location() string {
+	return configLocation(m.file, m.line, m.mapping)
+}
+
+// An action bound to a MIDI event by a mapping.
+type configBinding struct {
+	mapping *configMapping
+	// The MIDI event, which may differ from the mapping's own event
+	// (e.g., the events controlling a REPEAT-SEQUENCE).
+	event noteEvent
+	// What the event does in the mapping, if it isn't the mapping's own event (e.g., "next").
+	role string
+	// The keyboard key pressed by the event, if it isn't the mapping's key
+	// (e.g., the other pad of a DIAGONAL).
+	keyName string
+}
+
+// describe describes the action executed by the binding.
+func (b configBinding) describe() string {
+	m := b.mapping
+
+	desc := m.action
+	if b.role != "" {
+		desc += fmt.Sprintf(" (%s, of %s)", b.role, eventName(generateNoteEvent(m.evType, m.channel, m.key)))
+	} else if len(m.args) > 0 {
+		desc += " " + strings.Join(m.args, " ")
+	}
+	if m.appended {
+		desc = "+" + desc
+	}
+	for _, cond := range m.conditions {
+		desc += " if=" + cond
+	}
+
+	return desc
+}
+
+// eventName describes a MIDI event as it's written in the config (e.g., "ch=9 ev=0x24").
+func eventName(event noteEvent) string {
+	token := "ev"
+	if event[0]&0xf0 == midi.EventControlChange.ToUint8() {
+		token = "cc"
+	}
+
+	return fmt.Sprintf("ch=%d %s=%#x", event[0]&0x0f, token, event[1])
+}
+
+// Describes everything found while checking a config file.
+type ConfigReport struct {
+	// Every problem found in the config file, which would stop ReadConfig from loading it.
+	Problems []ConfigProblem
+	// Mappings that are probably mistakes (e.g., overridden mappings and unreachable named sets),
+	// but that don't stop the config file from being loaded.
+	Warnings []ConfigProblem
+
+	// The named sets, in the order they were declared.
+	sets []string
+	// The actions bound to each MIDI event, in each set (where the default set is an empty string).
+	bindings map[string]map[noteEvent][]configBinding
+}
+
+// CheckConfig reads the config file in path without opening any device,
+// reporting every problem in it, and warning about mappings that are probably mistakes.
+// If kitProfile isn't empty, it's read before the config file (see KeyEvents.SetKitProfile).
+func CheckConfig(path, kitProfile string) *ConfigReport {
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	kbEv := newKeyEvents(nullKeyController{}, nil, false, el)
+	kbEv.dryRun = true
+	kbEv.kitProfile = kitProfile
+	go kbEv.run()
+	defer kbEv.Close()
+
+	state := kbEv.newConfigState()
+	kbEv.readConfig(state, path)
+	kbEv.SetNamedSet(state.initialSet)
+	kbEv.restoreConfigState(state)
+
+	report := &ConfigReport{Problems: state.problems}
+	report.check(state.mappings)
+
+	return report
+}
+
+// check looks for mappings that are probably mistakes, and lists what each MIDI event does in each set.
+func (report *ConfigReport) check(mappings []configMapping) {
+	report.bindings = map[string]map[noteEvent][]configBinding{"": {}}
+
+	// The mapping declaring each named set, and the mappings activating each named set.
+	declared := make(map[string]*configMapping)
+	activated := make(map[string][]*configMapping)
+
+	for i := range mappings {
+		m := &mappings[i]
+
+		switch m.action {
+		case "NEW-MAPPING", "NEW-LAYER":
+			// Layers are described as "NAME[,MODE]".
+			name := strings.Split(m.args[0], ",")[0]
+			if _, ok := declared[name]; !ok {
+				report.sets = append(report.sets, name)
+			}
+			declared[name] = m
+			report.bindings[name] = make(map[noteEvent][]configBinding)
+			continue
+		case "USE-MAPPING", "PREV-MAPPING":
+			for _, name := range strings.Split(m.args[0], ",") {
+				activated[name] = append(activated[name], m)
+			}
+		case "SELECT-MAPPING", "HOLD-MAPPING":
+			activated[m.args[0]] = append(activated[m.args[0]], m)
+		}
+
+		if actionsWithoutEvent[m.action] {
+			continue
+		}
+
+		if m.threshold >= 127 {
+			report.warn(
+				m,
+				fmt.Sprintf("thres=%d", m.threshold),
+				ErrConfigThresholdUnreachable,
+				"velocities go up to 127, and actions only trigger above their threshold",
+			)
+		}
+
+		event := generateNoteEvent(m.evType, m.channel, m.key)
+		if m.action == "DIAGONAL" {
+			// Diagonals forward the events they don't handle to the actions previously
+			// registered to both pads, so they are added to them instead of replacing them.
+			// The other pad's own key is the last argument.
+			other, _ := strconv.ParseUint(m.args[0], 0, 8)
+			otherEvent := generateNoteEvent(m.evType, m.channel, uint8(other))
+			set := report.bindings[m.set]
+			set[event] = append(set[event], configBinding{mapping: m, event: event})
+			set[otherEvent] = append(set[otherEvent], configBinding{
+				mapping: m,
+				event:   otherEvent,
+				keyName: m.args[len(m.args)-1],
+			})
+			continue
+		}
+
+		report.bind(m, event, "")
+		if m.action == "REPEAT-SEQUENCE" {
+			for j, role := range []string{"prev", "next", "reset"} {
+				key, _ := strconv.ParseUint(m.args[2+j], 0, 8)
+				report.bind(m, generateNoteEvent(midi.EventNoteOn, m.channel, uint8(key)), role)
+			}
+		}
+	}
+
+	// Check that every activated set exists, in the order they were used.
+	var unknown []string
+	for name := range activated {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool {
+		return activated[unknown[i]][0].line < activated[unknown[j]][0].line
+	})
+	for _, name := range unknown {
+		for _, m := range activated[name] {
+			report.warn(m, name, ErrConfigSetUnknown, "declare the set (with NEW-MAPPING or NEW-LAYER), or check its name")
+		}
+	}
+
+	for _, name := range report.sets {
+		if len(activated[name]) == 0 {
+			report.warn(
+				declared[name],
+				name,
+				ErrConfigSetUnreachable,
+				"activate it with USE-MAPPING, PREV-MAPPING, SELECT-MAPPING or HOLD-MAPPING (scripts and plugins may still activate it)",
+			)
+		}
+	}
+
+	// The events controlling a sequence are checked before the sequence's own mappings,
+	// so they must also be checked against the default set.
+	for _, name := range report.sets {
+		for _, event := range sortedEvents(report.bindings[name]) {
+			for _, b := range report.bindings[name][event] {
+				for _, other := range report.bindings[""][event] {
+					if b.role != "" || other.role != "" {
+						report.collide(b, other)
+					}
+				}
+			}
+		}
+	}
+}
+
+// bind binds the mapping's action to event,
+// warning if it replaces (or is added to) the actions of a REPEAT-SEQUENCE's events.
+func (report *ConfigReport) bind(m *configMapping, event noteEvent, role string) {
+	set := report.bindings[m.set]
+	b := configBinding{mapping: m, event: event, role: role}
+
+	prev := set[event]
+	if m.appended || len(m.conditions) > 0 {
+		// Appended and conditional actions are kept with the event's other actions.
+		for _, other := range prev {
+			if role != "" || other.role != "" {
+				report.collide(b, other)
+			}
+		}
+		set[event] = append(prev, b)
+		return
+	}
+
+	for _, other := range prev {
+		if role != "" || other.role != "" {
+			report.collide(b, other)
+		} else {
+			report.warn(
+				m,
+				eventName(event),
+				ErrConfigMappingOverridden,
+				fmt.Sprintf("replaces the mapping at %s; prefix the line with '+' to keep both", other.mapping.location()),
+			)
+		}
+	}
+	set[event] = []configBinding{b}
+}
+
+// collide warns that an event controlling a REPEAT-SEQUENCE is also used by another mapping.
+func (report *ConfigReport) collide(b, other configBinding) {
+	if b.mapping == other.mapping {
+		return
+	}
+
+	report.warn(
+		b.mapping,
+		eventName(b.event),
+		ErrConfigSequenceCollision,
+		fmt.Sprintf("also mapped at %s; use different notes to control the sequence", other.mapping.location()),
+	)
+}
+
+// warn records a warning about mapping m.
+func (report *ConfigReport) warn(m *configMapping, token string, err error, hint string) {
+	report.Warnings = append(report.Warnings, ConfigProblem{
+		File:    m.file,
+		Line:    m.line,
+		Mapping: m.mapping,
+		Token:   token,
+		Err:     err,
+		Hint:    hint,
+	})
+}
+
+// sortedEvents lists the events by channel, then by type and then by key.
+func sortedEvents(bindings map[noteEvent][]configBinding) []noteEvent {
+	var events []noteEvent
+	for event := range bindings {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if a[0]&0x0f != b[0]&0x0f {
+			return a[0]&0x0f < b[0]&0x0f
+		} else if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		return a[1] < b[1]
+	})
+
+	return events
+}
+
+// HasMappings checks whether any MIDI event is mapped in any set.
+func (report *ConfigReport) HasMappings() bool {
+	for _, set := range report.bindings {
+		if len(set) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteTable writes a table describing what each MIDI event does in each set,
+// starting with the default set and followed by the named sets in the order they were declared.
+func (report *ConfigReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SET\tEVENT\tKEY\tACTION\tDEFINED AT")
+
+	for _, set := range append([]string{""}, report.sets...) {
+		name := set
+		if name == "" {
+			name = "(default)"
+		}
+
+		for _, event := range sortedEvents(report.bindings[set]) {
+			for _, b := range report.bindings[set][event] {
+				key := b.mapping.keyName
+				if b.keyName != "" {
+					key = b.keyName
+				}
+				if b.role != "" || strings.EqualFold(key, "NONE") {
+					key = "-"
+				}
+
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, eventName(event), key, b.describe(), b.mapping.location())
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+// A key controller that ignores every key, used to check config files without opening the keyboard.
+type nullKeyController struct{}
+
+func (nullKeyController) Close() error       { return nil }
+func (nullKeyController) PressKeys(...int)   {}
+func (nullKeyController) ReleaseKeys(...int) {}
@@ -0,0 +1,95 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	config := []string{
+		"ch=9 ev=0x24 key=A thres=30 BASIC 100",
+		"ch=9 ev=0x24 key=B thres=30 BASIC 100",
+		"+ch=9 ev=0x24 key=C thres=30 BASIC 100",
+		"ch=9 ev=0x25 key=A thres=127 BASIC 100",
+		"ch=9 ev=0x26 key=A thres=30 BASIC 100",
+		"ch=9 ev=0x29 key=NONE thres=30 USE-MAPPING str=FIRST,MISSING",
+		"ch=9 ev=0x27 key=A thres=30 NOT-AN-ACTION 1",
+		"ch=9 ev=0x2a key=NONE thres=0 NEW-MAPPING str=FIRST",
+		"ch=9 ev=0x2d key=UP thres=30 REPEAT-SEQUENCE 100 10 0x30 0x2b 0x26 str=RIGHT;DOWN",
+		"ch=9 ev=0x2b key=RIGHT thres=30 BASIC 100",
+		"ch=9 ev=0x2a key=NONE thres=0 NEW-MAPPING str=UNUSED",
+		"ch=9 ev=0x24 key=D thres=30 BASIC 100",
+		"ch=9 ev=0x24 key=UP thres=30 DIAGONAL 0x25 30 110 40 str=RIGHT",
+	}
+	wantProblems := []ConfigProblem{
+		{Line: 7, Token: "NOT-AN-ACTION", Err: ErrConfigActionInvalid},
+	}
+	wantWarnings := []ConfigProblem{
+		{Line: 2, Token: "ch=9 ev=0x24", Err: ErrConfigMappingOverridden},
+		{Line: 4, Token: "thres=127", Err: ErrConfigThresholdUnreachable},
+		{Line: 10, Token: "ch=9 ev=0x2b", Err: ErrConfigSequenceCollision},
+		{Line: 6, Token: "MISSING", Err: ErrConfigSetUnknown},
+		{Line: 11, Token: "UNUSED", Err: ErrConfigSetUnreachable},
+		{Line: 9, Token: "ch=9 ev=0x26", Err: ErrConfigSequenceCollision},
+	}
+
+	path := filepath.Join(t.TempDir(), "config.txt")
+	err := os.WriteFile(path, []byte(strings.Join(config, "\n")+"\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	report := CheckConfig(path, "")
+	assert(t, report.HasMappings(), "the report should have mappings")
+
+	for _, test := range []struct {
+		name string
+		got  []ConfigProblem
+		want []ConfigProblem
+	}{
+		{"problem", report.Problems, wantProblems},
+		{"warning", report.Warnings, wantWarnings},
+	} {
+		assert(t, len(test.got) == len(test.want), "expected %d %ss, got: %+v", len(test.want), test.name, test.got)
+		for i, got := range test.got {
+			want := test.want[i]
+			assert(t, got.File == path, "%s %d should be in '%s', got: '%s'", test.name, i, path, got.File)
+			assert(t, got.Line == want.Line, "%s %d should be in line %d, got: %d", test.name, i, want.Line, got.Line)
+			assert(t, got.Token == want.Token, "%s %d should be in token '%s', got: '%s'", test.name, i, want.Token, got.Token)
+			assert(t, errors.Is(got.Err, want.Err), "%s %d should be '%+v', got: '%+v'", test.name, i, want.Err, got.Err)
+			assert(t, got.Hint != "", "%s %d should have a hint", test.name, i)
+		}
+	}
+
+	// Test that the table lists the default set first, and the sequence's events in its set.
+	var table strings.Builder
+	err = report.WriteTable(&table)
+	assert(t, err == nil, "Failed to write the table: %+v", err)
+
+	for _, want := range []string{
+		"(default)  ch=9 ev=0x24  B",
+		"(default)  ch=9 ev=0x24  C      +BASIC 100",
+		"FIRST      ch=9 ev=0x2d  UP     REPEAT-SEQUENCE 100 10 0x30 0x2b 0x26 RIGHT;DOWN",
+		"FIRST      ch=9 ev=0x30  -      REPEAT-SEQUENCE (prev, of ch=9 ev=0x2d)",
+		"UNUSED     ch=9 ev=0x24  D",
+		"UNUSED     ch=9 ev=0x24  UP     DIAGONAL 0x25 30 110 40 RIGHT",
+		"UNUSED     ch=9 ev=0x25  RIGHT  DIAGONAL 0x25 30 110 40 RIGHT",
+	} {
+		assert(t, strings.Contains(table.String(), want), "the table should contain '%s', got:\n%s", want, table.String())
+	}
+	assert(
+		t,
+		strings.Index(table.String(), "(default)") < strings.Index(table.String(), "FIRST"),
+		"the default set should be listed first, got:\n%s",
+		table.String(),
+	)
+}
+
+func TestCheckConfigMissingFile(t *testing.T) {
+	report := CheckConfig(filepath.Join(t.TempDir(), "missing.txt"), "")
+
+	assert(t, len(report.Problems) == 1, "expected a single problem, got: %+v", report.Problems)
+	assert(t, errors.Is(report.Problems[0].Err, ErrOpenConfig), "expected '%+v', got: '%+v'", ErrOpenConfig, report.Problems[0].Err)
+	assert(t, !report.HasMappings(), "a missing file shouldn't have any mapping")
+}
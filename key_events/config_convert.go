@@ -0,0 +1,464 @@
+package key_events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/SirGFM/midi-go-key/err_wrap"
+)
+
+// A field of an orderedObject.
+type orderedField struct {
+	name  string
+	value interface{}
+}
+
+// A JSON object whose fields are encoded in the order they were added,
+// so converted config files list the fields as they were in the config line.
+type orderedObject []orderedField
+
+// set adds a field to the object.
+func (obj *orderedObject) set(name string, value interface{}) {
+	*obj = append(*obj, orderedField{name: name, value: value})
+}
+
+// encodeJSON encodes value without escaping HTML characters (e.g., '<' and '&'),
+// since converted configs are meant to be read and edited by people.
+func encodeJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func (obj orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, field := range obj {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := encodeJSON(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := encodeJSON(field.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// A config line, split into its tokens.
+type convertedLine struct {
+	// The comments preceding the line.
+	comment []string
+	// Whether the line starts with '+'.
+	append bool
+	// The text of each token, without its prefix.
+	ch, ev, key, thres, hold string
+	// Whether the event is a Control Change ("cc=").
+	isControlChange bool
+	// Every "if=" condition, without its prefix.
+	conditions []string
+	// The line's action.
+	action string
+	// The action's arguments, without their "str=" prefix.
+	args []string
+	// The kind of each of the action's arguments.
+	kinds []ArgKind
+	// The file included by the line, if it's an include (i.e., "include PATH").
+	include string
+}
+
+// splitLine splits a config line into its tokens, checking that every token is present,
+// but leaving the validation of their values to the parser.
+func splitLine(line string) (convertedLine, error) {
+	var conv convertedLine
+
+	if strings.HasPrefix(line, "+") {
+		conv.append = true
+		line = line[1:]
+	}
+
+	args := strings.Split(line, " ")
+	if len(args) < minArgs {
+		return conv, ErrConfigArgsBad
+	}
+
+	for _, token := range []struct {
+		prefix string
+		value  *string
+		err    error
+	}{
+		{"ch=", &conv.ch, ErrConfigChannelTokenMissing},
+		{"ev=", &conv.ev, ErrConfigEventTokenMissing},
+		{"key=", &conv.key, ErrConfigKeyTokenMissing},
+		{"thres=", &conv.thres, ErrConfigThresholdTokenMissing},
+	} {
+		arg := args[0]
+		if token.prefix == "ev=" && strings.HasPrefix(arg, "cc=") {
+			conv.isControlChange = true
+			arg = "ev=" + arg[len("cc="):]
+		}
+		if !strings.HasPrefix(arg, token.prefix) {
+			return conv, token.err
+		}
+
+		*token.value = arg[len(token.prefix):]
+		args = args[1:]
+	}
+
+	for len(args) > 0 && isMappingOption(args[0]) {
+		if strings.HasPrefix(args[0], "hold=") {
+			conv.hold = args[0][len("hold="):]
+		} else {
+			conv.conditions = append(conv.conditions, args[0][len("if="):])
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return conv, ErrConfigArgsBad
+	}
+
+	conv.action = args[0]
+	args = args[1:]
+	if params, ok := actionParams[conv.action]; ok {
+		for _, param := range params {
+			conv.kinds = append(conv.kinds, param.kind)
+		}
+	} else if customType, ok := lookupActionType(conv.action); ok {
+		conv.kinds = customType.args
+	} else {
+		return conv, ErrConfigActionInvalid
+	}
+
+	// Let the last argument, if it's a string, extend to the end of the line.
+	if last := len(conv.kinds) - 1; last >= 0 && len(args) > last+1 && strings.HasPrefix(args[last], "str=") {
+		args = append(args[:last], strings.Join(args[last:], " "))
+	}
+	if len(args) != len(conv.kinds) {
+		return conv, ErrConfigArgsBad
+	}
+
+	params := actionParams[conv.action]
+	for i, arg := range args {
+		isString := strings.HasPrefix(arg, "str=")
+		if isString != (conv.kinds[i] == ArgString) {
+			return conv, ErrConfigActionArgumentInvalid
+		}
+		arg = strings.TrimPrefix(arg, "str=")
+
+		// Arguments made of many values must be split into their fields.
+		if i < len(params) && params[i].fields != nil {
+			if _, ok := params[i].splitFields(arg); !ok {
+				return conv, ErrConfigActionArgumentInvalid
+			}
+		}
+		conv.args = append(conv.args, arg)
+	}
+
+	return conv, nil
+}
+
+// jsonNumber converts a token into a JSON number, if it's written in decimal,
+// or keeps it as a string otherwise (e.g., for hexadecimal values, like "0x2d").
+func jsonNumber(text string) interface{} {
+	if text == "" || (text[0] == '0' && text != "0") {
+		return text
+	}
+	for _, c := range text {
+		if c < '0' || c > '9' {
+			return text
+		}
+	}
+
+	return json.Number(text)
+}
+
+// jsonComment converts a list of comment lines into a single string,
+// if there's only a single line, or into a list of strings otherwise.
+func jsonComment(lines []string) interface{} {
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	switch len(lines) {
+	case 0:
+		return nil
+	case 1:
+		return lines[0]
+	default:
+		return lines
+	}
+}
+
+// mostCommon returns the value that appears the most times in values,
+// preferring the first one to appear on ties.
+func mostCommon(values []string) string {
+	var best string
+	count := make(map[string]int)
+	for _, value := range values {
+		count[value]++
+		if count[value] > count[best] {
+			best = value
+		}
+	}
+
+	return best
+}
+
+// mapping converts the line into a JSON mapping,
+// omitting every field that is set to its default value.
+func (conv convertedLine) mapping(ch, thres string) orderedObject {
+	var obj orderedObject
+
+	if comment := jsonComment(conv.comment); comment != nil {
+		obj.set("comment", comment)
+	}
+	if conv.append {
+		obj.set("append", true)
+	}
+
+	if !actionsWithoutEvent[conv.action] {
+		if conv.ch != ch {
+			obj.set("ch", jsonNumber(conv.ch))
+		}
+		if conv.isControlChange {
+			obj.set("cc", jsonNumber(conv.ev))
+		} else {
+			obj.set("ev", jsonNumber(conv.ev))
+		}
+	}
+	if !strings.EqualFold(conv.key, "NONE") {
+		obj.set("key", conv.key)
+	}
+	if !actionsWithoutEvent[conv.action] && conv.thres != thres {
+		obj.set("thres", jsonNumber(conv.thres))
+	}
+	if conv.hold != "" {
+		obj.set("hold", jsonNumber(conv.hold))
+	}
+	if len(conv.conditions) == 1 {
+		obj.set("if", conv.conditions[0])
+	} else if len(conv.conditions) > 1 {
+		obj.set("if", conv.conditions)
+	}
+
+	obj.set("action", conv.action)
+
+	params, isBuiltIn := actionParams[conv.action]
+	var customArgs []interface{}
+	for i, arg := range conv.args {
+		var value interface{} = arg
+		if conv.kinds[i] == ArgInt {
+			value = jsonNumber(arg)
+		}
+
+		if isBuiltIn && params[i].fields != nil {
+			fields, _ := params[i].splitFields(arg)
+			obj = append(obj, fields...)
+		} else if isBuiltIn {
+			obj.set(params[i].name, value)
+		} else {
+			customArgs = append(customArgs, value)
+		}
+	}
+	if !isBuiltIn {
+		obj.set("args", customArgs)
+	}
+
+	return obj
+}
+
+// ConvertConfig converts the text config file in path into the equivalent JSON config file.
+//
+// Comments are kept in the "comment" field of the mapping (or set) that follows them,
+// the most common channel and threshold become the file's defaults,
+// and every constant is listed in "define".
+func ConvertConfig(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, newConfigError(path, 0, err_wrap.Wrap(err, ErrOpenConfig))
+	}
+	defer file.Close()
+
+	// The lines outside of any set, and the lines of each set, which start with the set's declaration.
+	var lines []convertedLine
+	var sets [][]convertedLine
+	// The comments at the start and at the end of the file, and the ones before the next line.
+	var fileComment, comment []string
+	// The constants defined in the file.
+	var defines orderedObject
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+
+		if len(line) <= 0 {
+			// A comment separated from the first line by an empty line describes the whole file.
+			if len(lines) == 0 && len(sets) == 0 && len(fileComment) == 0 {
+				fileComment, comment = comment, nil
+			} else if len(comment) > 0 && comment[len(comment)-1] != "" {
+				comment = append(comment, "")
+			}
+			continue
+		} else if line[0] == '#' {
+			comment = append(comment, strings.TrimPrefix(line[1:], " "))
+			continue
+		}
+
+		if spec, ok := definition(line); ok {
+			// Constants are global, so they are all listed together, keeping the comments for the following line.
+			name, value, ok := strings.Cut(spec, "=")
+			if !ok {
+				return nil, newConfigError(path, lineNum, badToken(spec, ErrConfigDefineInvalid))
+			}
+			defines.set(name, jsonNumber(value))
+			continue
+		}
+
+		var conv convertedLine
+		if include, ok := includedPath(line); ok {
+			// Keep the comments for the following line, since includes can't have comments.
+			conv.include = include
+		} else {
+			conv, err = splitLine(line)
+			if err != nil {
+				return nil, newConfigError(path, lineNum, err)
+			}
+			conv.comment, comment = comment, nil
+		}
+
+		if conv.action == "NEW-MAPPING" || conv.action == "NEW-LAYER" {
+			sets = append(sets, []convertedLine{conv})
+		} else if len(sets) > 0 {
+			sets[len(sets)-1] = append(sets[len(sets)-1], conv)
+		} else {
+			lines = append(lines, conv)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newConfigError(path, 0, err_wrap.Wrap(err, ErrReadFile))
+	}
+
+	if len(comment) > 0 {
+		if len(fileComment) > 0 {
+			fileComment = append(fileComment, "")
+		}
+		fileComment = append(fileComment, comment...)
+	}
+
+	// Use the most common channel and threshold as the defaults.
+	var channels, thresholds []string
+	for _, conv := range append(lines, concatLines(sets)...) {
+		if conv.include == "" && !actionsWithoutEvent[conv.action] {
+			channels = append(channels, conv.ch)
+			thresholds = append(thresholds, conv.thres)
+		}
+	}
+	ch := mostCommon(channels)
+	thres := mostCommon(thresholds)
+
+	var config orderedObject
+	if comment := jsonComment(fileComment); comment != nil {
+		config.set("comment", comment)
+	}
+
+	if len(defines) > 0 {
+		config.set("define", defines)
+	}
+
+	var defaults orderedObject
+	if ch != "" {
+		defaults.set("ch", jsonNumber(ch))
+	}
+	if thres != "" {
+		defaults.set("thres", jsonNumber(thres))
+	}
+	if len(defaults) > 0 {
+		config.set("defaults", defaults)
+	}
+
+	setMappings(&config, lines, ch, thres)
+
+	if len(sets) > 0 {
+		var jsonSets []orderedObject
+		for _, set := range sets {
+			decl := set[0]
+
+			var obj orderedObject
+			if comment := jsonComment(decl.comment); comment != nil {
+				obj.set("comment", comment)
+			}
+
+			// Layers are described as "NAME[,MODE]".
+			name := strings.Split(decl.args[0], ",")
+			obj.set("name", name[0])
+			if decl.action == "NEW-LAYER" {
+				obj.set("layer", true)
+				if len(name) > 1 && strings.EqualFold(name[1], "OPAQUE") {
+					obj.set("opaque", true)
+				}
+			}
+
+			setMappings(&obj, set[1:], ch, thres)
+
+			jsonSets = append(jsonSets, obj)
+		}
+		config.set("sets", jsonSets)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(config); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// setMappings adds the lines to obj, in "mappings",
+// listing each included file in its place as {"include": PATH}.
+func setMappings(obj *orderedObject, lines []convertedLine, ch, thres string) {
+	mappings := []orderedObject{}
+	for _, conv := range lines {
+		if conv.include != "" {
+			var include orderedObject
+			include.set("include", conv.include)
+			mappings = append(mappings, include)
+		} else {
+			mappings = append(mappings, conv.mapping(ch, thres))
+		}
+	}
+
+	obj.set("mappings", mappings)
+}
+
+// concatLines joins every list of lines into a single list.
+func concatLines(lists [][]convertedLine) []convertedLine {
+	var lines []convertedLine
+	for _, list := range lists {
+		lines = append(lines, list...)
+	}
+
+	return lines
+}
@@ -0,0 +1,128 @@
+package key_events
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestConvertConfig(t *testing.T) {
+	config := []string{
+		"define KICK=0x24",
+		"# A comment.",
+		"ch=9 ev=KICK key=A thres=30 BASIC 100",
+		"ch=9 ev=38 key=B thres=20 hold=500 if=!held:A VELOCITY 10 100",
+		"ch=1 cc=4 key=NONE thres=63 HOLD-MAPPING str=SET_A",
+		"+ch=9 ev=0x24 key=NONE thres=30 EXEC 1000 1 str=notify-send a <b> & c",
+		"ch=0 ev=0 key=NONE thres=0 VAR str=SLOT,1,9",
+		"ch=9 ev=0x25 key=NONE thres=30 VAR-INC str=SLOT,WRAP",
+		"ch=9 ev=0x26 key=NONE thres=30 VAR-SET str=SLOT,-1",
+		"ch=0 ev=0 key=NONE thres=0 SOCD str=LEFT,RIGHT,NEUTRAL",
+		"ch=9 ev=0x27 key=NONE thres=30 VAR-KEY 100 str=SLOT:A;B,C",
+		"ch=9 ev=0x24 key=NONE thres=30 NEW-LAYER str=SET_A,OPAQUE",
+		"ch=9 ev=0x24 key=C thres=30 TEST-TAP 20 str=A",
+		"include kits/layer.txt",
+	}
+	// The lines generated from the converted config,
+	// where every unused token is replaced by its default value.
+	want := []string{
+		"ch=9 ev=KICK key=A thres=30 BASIC 100",
+		"ch=9 ev=38 key=B thres=20 hold=500 if=!held:A VELOCITY 10 100",
+		"ch=1 cc=4 key=NONE thres=63 HOLD-MAPPING str=SET_A",
+		"+ch=9 ev=0x24 key=NONE thres=30 EXEC 1000 1 str=notify-send a <b> & c",
+		"ch=9 ev=0 key=NONE thres=30 VAR str=SLOT,1,9",
+		"ch=9 ev=0x25 key=NONE thres=30 VAR-INC str=SLOT,WRAP",
+		"ch=9 ev=0x26 key=NONE thres=30 VAR-SET str=SLOT,-1",
+		"ch=9 ev=0 key=NONE thres=30 SOCD str=LEFT,RIGHT,NEUTRAL",
+		"ch=9 ev=0x27 key=NONE thres=30 VAR-KEY 100 str=SLOT:A;B,C",
+		"ch=9 ev=0x24 key=C thres=30 TEST-TAP 20 str=A",
+	}
+
+	path := filepath.Join(t.TempDir(), "config.txt")
+	err := os.WriteFile(path, []byte(strings.Join(config, "\n")+"\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	data, err := ConvertConfig(path)
+	assert(t, err == nil, "Failed to convert the config: %+v", err)
+	assert(t, bytes.Contains(data, []byte("<b> & c")), "HTML characters shouldn't be escaped:\n%s", data)
+
+	var converted jsonConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&converted)
+	assert(t, err == nil, "Failed to decode the converted config: %+v\n%s", err, data)
+
+	assert(t, converted.Define["KICK"] == "0x24", "the constant should be defined, got: %+v", converted.Define)
+	assert(t, converted.Mappings[0]["comment"] == "A comment.", "the comment should be kept, got: %+v", converted.Mappings[0]["comment"])
+	for i, fields := range []map[string]interface{}{
+		{"name": "SLOT", "min": json.Number("1"), "max": json.Number("9")},
+		{"name": "SLOT", "wrap": true},
+		{"name": "SLOT", "value": json.Number("-1")},
+		{"mode": "NEUTRAL"},
+		{"name": "SLOT", "keys": "A;B,C"},
+	} {
+		mapping := converted.Mappings[4+i]
+		for name, value := range fields {
+			assert(t, mapping[name] == value, "field '%s' of %+v should be %+v, got: %+v", name, mapping, value, mapping[name])
+		}
+	}
+	keys, _ := jsonToken(converted.Mappings[7]["keys"])
+	assert(t, keys == "LEFT,RIGHT", "the SOCD keys should be 'LEFT,RIGHT', got: '%s'", keys)
+
+	assert(t, len(converted.Sets) == 1, "expected a single set, got: %d", len(converted.Sets))
+	set := converted.Sets[0]
+	assert(t, set.Name == "SET_A" && set.Layer && set.Opaque, "expected an opaque layer SET_A, got: %+v", set)
+	assert(t, len(set.Mappings) == 2, "expected the set's mapping and include, got: %+v", set.Mappings)
+	include, isInclude, err := set.Mappings[1].included()
+	assert(t, isInclude && err == nil && include == "kits/layer.txt", "the set should include its file after its mapping, got: %+v", set.Mappings)
+
+	var got []string
+	for _, mapping := range converted.Mappings {
+		line, err := mapping.line(converted.Defaults)
+		assert(t, err == nil, "Failed to convert the mapping back into a line: %+v", err)
+		got = append(got, line)
+	}
+	for _, mapping := range set.Mappings[:1] {
+		line, err := mapping.line(converted.Defaults.merge(set.Defaults))
+		assert(t, err == nil, "Failed to convert the mapping back into a line: %+v", err)
+		got = append(got, line)
+	}
+
+	assert(t, len(got) == len(want), "expected %d lines, got: %+v", len(want), got)
+	for i := range want {
+		assert(t, got[i] == want[i], "line %d should be '%s', got: '%s'", i, want[i], got[i])
+	}
+}
+
+func TestConvertExistingConfigs(t *testing.T) {
+	paths, err := filepath.Glob("../configs/*.txt")
+	assert(t, err == nil && len(paths) > 0, "Failed to list the configs: %+v", err)
+
+	for _, path := range paths {
+		data, err := ConvertConfig(path)
+		assert(t, err == nil, "Failed to convert '%s': %+v", path, err)
+
+		jsonPath := filepath.Join(t.TempDir(), "config.json")
+		err = os.WriteFile(jsonPath, data, 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+
+		conn := make(chan midi.MidiEvent, 1)
+		el := event_logger.New(nil)
+		ke, err := NewKeyEvents(NewMockKeyController(), conn, false, el)
+		assert(t, err == nil, "Failed to start the key event generator")
+
+		err = ke.ReadConfig(jsonPath)
+		assert(t, err == nil, "Failed to read the config converted from '%s': %+v", path, err)
+
+		ke.Close()
+		el.Close()
+		close(conn)
+	}
+}
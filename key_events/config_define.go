@@ -0,0 +1,108 @@
+package key_events
+
+import (
+	"strings"
+)
+
+// List the prefixes of the tokens whose values may be replaced by a constant (e.g., "ev=KICK").
+// Action arguments without a prefix (e.g., the notes controlling a REPEAT-SEQUENCE) may also be replaced.
+var definablePrefixes = []string{
+	"ch=",
+	"ev=",
+	"cc=",
+	"thres=",
+	"hold=",
+}
+
+// definition checks whether line defines a constant (i.e., "define NAME=VALUE"),
+// returning the definition.
+func definition(line string) (string, bool) {
+	if !strings.HasPrefix(line, "define ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[len("define "):]), true
+}
+
+// isConstantName checks whether name may be used as a constant:
+// it must start with a letter, followed by letters, digits, '_' or '-',
+// and it can't be the name of an action.
+func isConstantName(name string) bool {
+	if name == "" || !isLetter(rune(name[0])) {
+		return false
+	}
+	for _, c := range name {
+		if !isLetter(c) && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+
+	_, isAction := actionsToArgCount[name]
+	_, isCustom := lookupActionType(name)
+	return !isAction && !isCustom
+}
+
+// isLetter checks whether c is an ASCII letter.
+func isLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// define records the constant defined by spec (i.e., "NAME=VALUE").
+// Constants may be redefined, in which case the following lines use the new value.
+func (state *configState) define(spec string) error {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok || !isConstantName(name) || value == "" || strings.ContainsAny(value, " \t") {
+		return badToken(spec, ErrConfigDefineInvalid)
+	}
+
+	if state.defines == nil {
+		state.defines = make(map[string]string)
+	}
+	state.defines[name] = value
+
+	return nil
+}
+
+// expand replaces every constant in the tokens of a config line by its value,
+// stopping at the first string argument (which may have spaces, and thus is never replaced).
+func (state *configState) expand(args []string) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "str=") {
+			return
+		}
+
+		if strings.HasPrefix(arg, "if=") {
+			args[i] = "if=" + state.expandCondition(arg[len("if="):])
+			continue
+		}
+
+		var prefix string
+		for _, definable := range definablePrefixes {
+			if strings.HasPrefix(arg, definable) {
+				prefix = definable
+			}
+		}
+		if prefix == "" && strings.Contains(arg, "=") {
+			// Skip other tokens (e.g., "key=").
+			continue
+		}
+
+		if value, ok := state.defines[arg[len(prefix):]]; ok {
+			args[i] = prefix + value
+		}
+	}
+}
+
+// expandCondition replaces the event of a "hit:EV:MS" condition by its value, if it's a constant.
+func (state *configState) expandCondition(spec string) string {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || strings.TrimPrefix(parts[0], "!") != "hit" {
+		return spec
+	}
+
+	if value, ok := state.defines[parts[1]]; ok {
+		parts[1] = value
+	}
+
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,186 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestDefineConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyA := keyNameToInt["A"]
+	keyUp := keyNameToInt["UP"]
+	keyRight := keyNameToInt["RIGHT"]
+
+	dir := t.TempDir()
+	files := map[string][]string{
+		"kit.txt": {
+			"define DRUMS=9",
+			"define KICK=0x24",
+			"define SNARE=0x26",
+			"define TOM1=0x30",
+			"define TOM2=0x2d",
+			"define TOM3=0x2b",
+			"define 1TOM=0x29",
+			"define BASIC=0x29",
+		},
+		"game.txt": {
+			"ch=DRUMS ev=KICK key=A thres=30 BASIC 20",
+			"ch=DRUMS ev=TOM2 key=UP thres=0 REPEAT-SEQUENCE 100 10 TOM1 TOM3 SNARE str=RIGHT",
+			"ch=DRUMS ev=HIHAT key=A thres=30 BASIC 20",
+		},
+		"game.json": {
+			`{`,
+			`	"define": {"LONG": 20},`,
+			`	"defaults": {"ch": "DRUMS", "thres": 30},`,
+			`	"mappings": [`,
+			`		{"ev": "KICK", "key": "A", "action": "BASIC", "release_ms": "LONG"},`,
+			`		{"ev": "TOM2", "key": "UP", "thres": 0, "action": "REPEAT-SEQUENCE", "repeat_ms": 100, "short_release_ms": 10,`,
+			`			"prev_ev": "TOM1", "next_ev": "TOM3", "reset_ev": "SNARE", "keys": "RIGHT"},`,
+			`		{"ev": "HIHAT", "key": "A", "action": "BASIC", "release_ms": 20}`,
+			`	]`,
+			`}`,
+		},
+	}
+	for name, lines := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+	}
+
+	kit := filepath.Join(dir, "kit.txt")
+	want := []ConfigProblem{
+		{File: kit, Line: 7, Token: "1TOM=0x29", Err: ErrConfigDefineInvalid},
+		{File: kit, Line: 8, Token: "BASIC=0x29", Err: ErrConfigDefineInvalid},
+		{Token: "ev=HIHAT", Err: ErrConfigEventInvalid},
+	}
+
+	for _, name := range []string{"game.txt", "game.json"} {
+		conn := make(chan midi.MidiEvent, 1)
+		kc := NewMockKeyController(keyA, keyUp, keyRight)
+		el := event_logger.New(nil)
+
+		ke, err := NewKeyEvents(kc, conn, false, el)
+		assert(t, err == nil, "Failed to start the key event generator")
+		ke.SetKitProfile(kit)
+
+		err = ke.ReadConfig(filepath.Join(dir, name))
+		var configErr *ConfigError
+		assert(t, errors.As(err, &configErr), "%s: expected a ConfigError, got: %+v", name, err)
+		assert(t, len(configErr.Problems) == len(want), "%s: expected %d problems, got: %+v", name, len(want), err)
+		for i, problem := range configErr.Problems {
+			if want[i].File != "" {
+				assert(t, problem.File == want[i].File, "%s: problem %d should be in '%s', got: '%s'", name, i, want[i].File, problem.File)
+				assert(t, problem.Line == want[i].Line, "%s: problem %d should be in line %d, got: %d", name, i, want[i].Line, problem.Line)
+			}
+			assert(t, problem.Token == want[i].Token, "%s: problem %d should be in token '%s', got: '%s'", name, i, want[i].Token, problem.Token)
+			assert(t, errors.Is(problem.Err, want[i].Err), "%s: problem %d should be '%+v', got: '%+v'", name, i, want[i].Err, problem.Err)
+		}
+
+		// Test that the constants were replaced by their values.
+		sendMidiEvent(evType, channel, 0x24, 100, conn)
+		assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+
+		// Advance the sequence with TOM3, and press its current key with TOM2.
+		sendMidiEvent(evType, channel, 0x2b, 100, conn)
+		sendMidiEvent(evType, channel, 0x2d, 100, conn)
+		assertKeyStates(t, kc[keyRight], 40*time.Millisecond, true, false)
+
+		ke.Close()
+		close(conn)
+		el.Close()
+	}
+}
+
+func TestNoteNamesConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	config := []string{
+		"ch=9 ev=acoustic-snare key=A thres=30 BASIC 20",
+		"ch=9 ev=C#2 key=B thres=30 BASIC 20",
+		"ch=9 cc=C#2 key=NONE thres=30 HOLD-MAPPING str=SET_A",
+	}
+	path := filepath.Join(t.TempDir(), "config.txt")
+	err = os.WriteFile(path, []byte(strings.Join(config, "\n")+"\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	// Controllers can't be named, since they aren't notes.
+	err = ke.ReadConfig(path)
+	var configErr *ConfigError
+	assert(t, errors.As(err, &configErr), "expected a ConfigError, got: %+v", err)
+	assert(t, len(configErr.Problems) == 1, "expected a single problem, got: %+v", err)
+	assert(t, configErr.Problems[0].Line == 3, "the problem should be in line 3, got: %+v", err)
+	assert(t, errors.Is(configErr.Problems[0].Err, ErrConfigEventInvalid), "expected an invalid event, got: %+v", err)
+
+	sendMidiEvent(evType, channel, 38, 100, conn)
+	assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+	sendMidiEvent(evType, channel, 37, 100, conn)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+}
+
+func TestHitConditionConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// The events of "hit:" conditions may be written exactly like "ev=".
+	config := []string{
+		"define KICK=0x24",
+		"ch=9 ev=0x26 key=A thres=30 if=hit:KICK:200 BASIC 20",
+		"ch=9 ev=0x27 key=B thres=30 if=hit:C#2:200 BASIC 20",
+	}
+	path := filepath.Join(t.TempDir(), "config.txt")
+	err = os.WriteFile(path, []byte(strings.Join(config, "\n")+"\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	err = ke.ReadConfig(path)
+	assert(t, err == nil, "Failed to read the config: %+v", err)
+
+	sendMidiEvent(evType, channel, 0x24, 100, conn)
+	sendMidiEvent(evType, channel, 0x26, 100, conn)
+	assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+
+	sendMidiEvent(evType, channel, 0x27, 100, conn)
+	select {
+	case <-kc[keyB].newState:
+		t.Fatalf("'B' shouldn't be pressed before C#2 is hit")
+	case <-time.After(10 * time.Millisecond):
+	}
+	sendMidiEvent(evType, channel, 37, 100, conn)
+	sendMidiEvent(evType, channel, 0x27, 100, conn)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+}
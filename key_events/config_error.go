@@ -0,0 +1,218 @@
+package key_events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A single problem found while reading a config file.
+type ConfigProblem struct {
+	// The config file.
+	File string
+	// The line with the problem, starting at 1, or 0 if the problem isn't in a specific line.
+	Line int
+	// The mapping with the problem in JSON config files (e.g., "sets[0].mappings[2]").
+	Mapping string
+	// The offending token (e.g., "ch=16"), or the offending field in JSON config files,
+	// if the problem was caused by a single token.
+	Token string
+	// The problem, which is usually (or wraps) one of this package's errors.
+	Err error
+	// A hint on how to fix the problem, if any.
+	Hint string
+}
+
+// configLocation describes where something was defined in a config file (e.g., "config.txt:12").
+func configLocation(file string, line int, mapping string) string {
+	location := file
+	if line > 0 {
+		location += fmt.Sprintf(":%d", line)
+	}
+	if mapping != "" {
+		location += ":" + mapping
+	}
+
+	return location
+}
+
+func (p ConfigProblem) String() string {
+	msg := configLocation(p.File, p.Line, p.Mapping) + ": "
+	if p.Token != "" {
+		msg += fmt.Sprintf("'%s': ", p.Token)
+	}
+	msg += p.Err.Error()
+	if p.Hint != "" {
+		msg += " (hint: " + p.Hint + ")"
+	}
+
+	return msg
+}
+
+// Lists every problem found while reading a config file.
+// Lines with problems are skipped, but the rest of the file is still read,
+// so every problem is reported at once.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	msgs := []string{fmt.Sprintf("(key_events) found %d problem(s) in the config file", len(e.Problems))}
+	for _, problem := range e.Problems {
+		msgs = append(msgs, "\t"+problem.String())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Is checks whether any of the problems is target,
+// so specific problems may be checked with errors.Is.
+func (e *ConfigError) Is(target error) bool {
+	for _, problem := range e.Problems {
+		if errors.Is(problem.Err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// An error caused by a single token of a config line.
+type tokenError struct {
+	token string
+	err   error
+}
+
+// badToken reports that token caused err.
+func badToken(token string, err error) error {
+	return tokenError{token: token, err: err}
+}
+
+func (e tokenError) Error() string {
+	return fmt.Sprintf("'%s': %s", e.token, e.err)
+}
+
+func (e tokenError) Unwrap() error {
+	return e.err
+}
+
+// Lists multiple errors found in a single config line (e.g., multiple invalid keys).
+type lineErrors []error
+
+func (errs lineErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// configHint suggests how to fix err, if it's one of this package's errors.
+func configHint(err error) string {
+	var code errCode
+	if !errors.As(err, &code) {
+		return ""
+	}
+
+	switch code {
+	case ErrConfigArgsBad:
+		return `lines are written as "ch=CH ev=EV key=KEY thres=THRES [OPTIONS] ACTION ARGS", with the number of arguments expected by the action`
+	case ErrConfigChannelTokenMissing:
+		return `lines must start with the channel (e.g., "ch=9")`
+	case ErrConfigChannelTokenInvalid:
+		return "channels go from 0 to 15 (e.g., drum kits usually send on channel 9)"
+	case ErrConfigEventTokenMissing:
+		return `the channel must be followed by the event (e.g., "ev=0x24", or "cc=4" for Control Changes)`
+	case ErrConfigEventInvalid:
+		return `events go from 0 to 255, either in decimal, in hexadecimal (e.g., "0x24"), as a note (e.g., "C#2" or "acoustic-snare") or as a constant defined before the line (e.g., "KICK")`
+	case ErrConfigKeyTokenMissing:
+		return `the event must be followed by the key (e.g., "key=A", or "key=NONE" if it isn't used)`
+	case ErrConfigKeyInvalid:
+		return `keys are named like "A", "SPACE", "LEFT" or "F1", and "NONE" may only be used if the key isn't pressed`
+	case ErrConfigThresholdTokenMissing:
+		return `the key must be followed by the threshold (e.g., "thres=30")`
+	case ErrConfigThresholdInvalid:
+		return "thresholds go from 0 to 255, compared against the velocity of the MIDI event"
+	case ErrConfigActionInvalid:
+		return "the action must be one of the actions listed in the README, or a registered custom action"
+	case ErrConfigActionArgumentInvalid:
+		return `numeric arguments must be positive integers, and string arguments must start with "str="`
+	case ErrConfigControlChangeInvalid:
+		return `only HOLD-MAPPING (and custom actions) may use "cc=", other actions must use "ev="`
+	case ErrConfigSetActionOutsideSet:
+		return "declare the set (with NEW-MAPPING or NEW-LAYER) before this line"
+	case ErrConfigOptionInvalid:
+		return `"hold=" takes milliseconds, and "if=" one of "held:KEY", "set:NAME", "hit:EV:MS" or "var:NAME:VALUE"`
+	case ErrConfigVariableUnknown:
+		return "declare the variable (with VAR) before this line"
+	case ErrConfigScriptInvalid:
+		return `scripts are written as "str=FILE:FUNCTION", where FILE is relative to the config file`
+	case ErrConfigPluginUnknown:
+		return "declare the plugin (with PLUGIN) before this line"
+	case ErrConfigJSONInvalid:
+		return `the file must be a JSON object with "defaults", "mappings" and "sets"`
+	case ErrConfigFieldInvalid:
+		return "check the fields of the action (and their types) in the README"
+	case ErrConfigDefineInvalid:
+		return `names start with a letter, followed by letters, digits, '_' or '-' (e.g., "define KICK=0x24"), and values can't have spaces`
+	case ErrConfigIncludeCycle:
+		return "move the mappings shared by both files into a third file, included by both"
+	default:
+		return ""
+	}
+}
+
+// configProblems converts an error returned while parsing a line (or a JSON mapping) into its problems.
+func configProblems(file string, line int, mapping string, err error) []ConfigProblem {
+	errs, ok := err.(lineErrors)
+	if !ok {
+		errs = lineErrors{err}
+	}
+
+	var problems []ConfigProblem
+	for _, err := range errs {
+		problem := ConfigProblem{
+			File:    file,
+			Line:    line,
+			Mapping: mapping,
+			Err:     err,
+		}
+
+		var tokErr tokenError
+		if errors.As(err, &tokErr) {
+			problem.Token = tokErr.token
+			problem.Err = tokErr.err
+		}
+		problem.Hint = configHint(problem.Err)
+
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
+
+// newConfigError reports a problem that stopped the config file from being read (e.g., a missing file).
+func newConfigError(file string, line int, err error) error {
+	return &ConfigError{Problems: configProblems(file, line, "", err)}
+}
+
+// jsonErrorLine returns the line of data where the JSON decoding error happened,
+// or 0 if it's unknown.
+func jsonErrorLine(data []byte, err error) int {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+
+	if offset <= 0 || offset > int64(len(data)) {
+		return 0
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,118 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestConfigError(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyCode := keyNameToInt["A"]
+
+	config := []string{
+		"ch=16 ev=0x24 key=NOT-A-KEY thres=30 BASIC 100",
+		"ch=9 ev=0x25 key=A thres=30 BASIC 20",
+		"ch=9 ev=0x26 key=A thres=30 REPEAT-SEQUENCE 100 10 0x30 0x2b 0x26 str=B,NOPE;C;ALSO-NOPE",
+		"ch=9 ev=0x27 key=A thres=30 NOT-AN-ACTION 1",
+	}
+	want := []ConfigProblem{
+		{Line: 1, Token: "ch=16", Err: ErrConfigChannelTokenInvalid},
+		{Line: 1, Token: "key=NOT-A-KEY", Err: ErrConfigKeyInvalid},
+		{Line: 3, Token: "NOPE", Err: ErrConfigKeyInvalid},
+		{Line: 3, Token: "ALSO-NOPE", Err: ErrConfigKeyInvalid},
+		{Line: 4, Token: "NOT-AN-ACTION", Err: ErrConfigActionInvalid},
+	}
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	path := filepath.Join(t.TempDir(), "config.txt")
+	err = os.WriteFile(path, []byte(strings.Join(config, "\n")+"\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	err = ke.ReadConfig(path)
+	var configErr *ConfigError
+	assert(t, errors.As(err, &configErr), "expected a ConfigError, got: %+v", err)
+	assert(t, errors.Is(err, ErrConfigKeyInvalid), "the error should match its problems, got: %+v", err)
+
+	// Test that every problem was reported, in order.
+	assert(t, len(configErr.Problems) == len(want), "expected %d problems, got: %+v", len(want), err)
+	for i, problem := range configErr.Problems {
+		assert(t, problem.File == path, "problem %d should be in '%s', got: '%s'", i, path, problem.File)
+		assert(t, problem.Line == want[i].Line, "problem %d should be in line %d, got: %d", i, want[i].Line, problem.Line)
+		assert(t, problem.Token == want[i].Token, "problem %d should be in token '%s', got: '%s'", i, want[i].Token, problem.Token)
+		assert(t, errors.Is(problem.Err, want[i].Err), "problem %d should be '%+v', got: '%+v'", i, want[i].Err, problem.Err)
+		assert(t, problem.Hint != "", "problem %d should have a hint", i)
+	}
+
+	// Test that the valid lines were still registered.
+	sendMidiEvent(evType, channel, 0x25, 100, conn)
+	assertKeyStates(t, kc[keyCode], 40*time.Millisecond, true, false)
+}
+
+func TestConfigErrorJSON(t *testing.T) {
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(NewMockKeyController(), conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// readProblems writes the config to a JSON file and returns the problems found while reading it.
+	readProblems := func(config string) []ConfigProblem {
+		path := filepath.Join(t.TempDir(), "config.json")
+		err := os.WriteFile(path, []byte(config), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+
+		err = ke.ReadConfig(path)
+		var configErr *ConfigError
+		assert(t, errors.As(err, &configErr), "expected a ConfigError, got: %+v", err)
+		return configErr.Problems
+	}
+
+	// Test that syntax errors are reported in their line.
+	problems := readProblems("{\n\t\"mappings\": [\n\t\t{\"ev\": 1,}\n\t]\n}\n")
+	assert(t, len(problems) == 1 && problems[0].Line == 3, "expected a single problem in line 3, got: %+v", problems)
+
+	// Test that every invalid mapping is reported.
+	problems = readProblems(`{
+		"mappings": [
+			{"ev": 1, "key": "A", "action": "BASIC"},
+			{"ev": 2, "key": "A", "action": "BASIC", "release_ms": 20},
+			{"ev": 3, "key": "NOT-A-KEY", "action": "BASIC", "release_ms": 20}
+		],
+		"sets": [
+			{"name": "", "mappings": [{"ev": 4, "action": "NOT-AN-ACTION"}]}
+		]
+	}`)
+	want := []ConfigProblem{
+		{Mapping: "mappings[0]", Token: "release_ms", Err: ErrConfigFieldInvalid},
+		{Mapping: "mappings[2]", Token: "key=NOT-A-KEY", Err: ErrConfigKeyInvalid},
+		{Mapping: "sets[0]", Token: "name", Err: ErrConfigFieldInvalid},
+	}
+	assert(t, len(problems) == len(want), "expected %d problems, got: %+v", len(want), problems)
+	for i, problem := range problems {
+		assert(t, problem.Mapping == want[i].Mapping, "problem %d should be in '%s', got: '%s'", i, want[i].Mapping, problem.Mapping)
+		assert(t, problem.Token == want[i].Token, "problem %d should be in token '%s', got: '%s'", i, want[i].Token, problem.Token)
+		assert(t, errors.Is(problem.Err, want[i].Err), "problem %d should be '%+v', got: '%+v'", i, want[i].Err, problem.Err)
+	}
+}
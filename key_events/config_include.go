@@ -0,0 +1,56 @@
+package key_events
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SirGFM/midi-go-key/err_wrap"
+)
+
+// includedPath checks whether line includes another config file (i.e., "include PATH"),
+// returning the included file's path.
+func includedPath(line string) (string, bool) {
+	if !strings.HasPrefix(line, "include ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(line[len("include "):]), true
+}
+
+// absPath returns the absolute path of path, if it may be resolved.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
+
+// includeConfig reads the config file included by the file in from,
+// as if its lines were in the including file.
+// Relative paths are relative to the including file's directory.
+func (kbEv *keyEvents) includeConfig(state *configState, from, include string) error {
+	path := include
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+
+	for _, file := range state.files {
+		if file == absPath(path) {
+			return badToken(include, ErrConfigIncludeCycle)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return badToken(include, err_wrap.Wrap(err, ErrOpenConfig))
+	}
+
+	// Problems in the included file are reported in that file,
+	// so restore the location of the include once it's read.
+	file, line, mapping := state.file, state.line, state.mapping
+	kbEv.readConfigFile(state, path)
+	state.file, state.line, state.mapping = file, line, mapping
+	kbEv.location = configLocation(file, line, mapping)
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestIncludeConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+	keyC := keyNameToInt["C"]
+
+	dir := t.TempDir()
+	files := map[string][]string{
+		"game.txt": {
+			"include kits/kit.txt",
+			"ch=9 ev=0x25 key=B thres=30 BASIC 20",
+		},
+		"game.json": {
+			`{`,
+			`	"include": ["kits/kit.txt"],`,
+			`	"mappings": [{"ch": 9, "ev": "0x25", "key": "B", "thres": 30, "action": "BASIC", "release_ms": 20}]`,
+			`}`,
+		},
+		"game-mappings.json": {
+			`{`,
+			`	"mappings": [`,
+			`		{"comment": "Shared by every game.", "include": "kits/kit.txt"},`,
+			`		{"ch": 9, "ev": "0x25", "key": "B", "thres": 30, "action": "BASIC", "release_ms": 20}`,
+			`	]`,
+			`}`,
+		},
+		"kits/kit.txt": {
+			"# Shared by every game.",
+			"include shared.txt",
+			"ch=9 ev=0x24 key=A thres=30 BASIC 20",
+		},
+		"kits/shared.txt": {
+			"ch=9 ev=0x26 key=C thres=30 BASIC 20",
+			"ch=16 ev=0x27 key=C thres=30 BASIC 20",
+			"include kit.txt",
+			"include missing.txt",
+		},
+	}
+	for name, lines := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		assert(t, err == nil, "Failed to create the config's directory: %+v", err)
+		err = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+	}
+
+	shared := filepath.Join(dir, "kits", "shared.txt")
+	want := []ConfigProblem{
+		{File: shared, Line: 2, Token: "ch=16", Err: ErrConfigChannelTokenInvalid},
+		{File: shared, Line: 3, Token: "kit.txt", Err: ErrConfigIncludeCycle},
+		{File: shared, Line: 4, Token: "missing.txt", Err: ErrOpenConfig},
+	}
+
+	for _, name := range []string{"game.txt", "game.json", "game-mappings.json"} {
+		conn := make(chan midi.MidiEvent, 1)
+		kc := NewMockKeyController(keyA, keyB, keyC)
+		el := event_logger.New(nil)
+
+		ke, err := NewKeyEvents(kc, conn, false, el)
+		assert(t, err == nil, "Failed to start the key event generator")
+
+		// Test that problems are reported in the included file.
+		err = ke.ReadConfig(filepath.Join(dir, name))
+		var configErr *ConfigError
+		assert(t, errors.As(err, &configErr), "%s: expected a ConfigError, got: %+v", name, err)
+		assert(t, len(configErr.Problems) == len(want), "%s: expected %d problems, got: %+v", name, len(want), err)
+		for i, problem := range configErr.Problems {
+			assert(t, problem.File == want[i].File, "%s: problem %d should be in '%s', got: '%s'", name, i, want[i].File, problem.File)
+			assert(t, problem.Line == want[i].Line, "%s: problem %d should be in line %d, got: %d", name, i, want[i].Line, problem.Line)
+			assert(t, problem.Token == want[i].Token, "%s: problem %d should be in token '%s', got: '%s'", name, i, want[i].Token, problem.Token)
+			assert(t, errors.Is(problem.Err, want[i].Err), "%s: problem %d should be '%+v', got: '%+v'", name, i, want[i].Err, problem.Err)
+		}
+
+		// Test that the mappings of every file were registered.
+		sendMidiEvent(evType, channel, 0x24, 100, conn)
+		assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+		sendMidiEvent(evType, channel, 0x25, 100, conn)
+		assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+		sendMidiEvent(evType, channel, 0x26, 100, conn)
+		assertKeyStates(t, kc[keyC], 40*time.Millisecond, true, false)
+
+		ke.Close()
+		close(conn)
+		el.Close()
+	}
+}
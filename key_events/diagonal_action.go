@@ -0,0 +1,126 @@
+package key_events
+
+import (
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func (kbEv *keyEvents) RegisterDiagonalAction(
+	evType midi.MidiEventType,
+	channel,
+	key,
+	otherKey uint8,
+	keyCodes []int,
+	threshold uint8,
+	windowMs,
+	maxRepeatDelayMs int32,
+	shortRelease time.Duration,
+) {
+	events := [2]noteEvent{
+		generateNoteEvent(evType, channel, key),
+		generateNoteEvent(evType, channel, otherKey),
+	}
+	keys := [2]uint8{key, otherKey}
+
+	// The actions previously registered to each pad, which handle
+	// every event that doesn't trigger the diagonal.
+	var singles [2]namedMidiAction
+	for i, event := range events {
+		singles[i], _ = kbEv.registeredAction(event)
+	}
+
+	// Create a new key handler for the combined keys.
+	keyAction := kbEv.newKeyActionMulti(keyCodes, nil)
+
+	// Whether the pads are currently being repeated as a diagonal.
+	var isStarted bool
+	// Whether each pad has ever been hit.
+	var wasHit [2]bool
+	// Stores the last time each pad was hit.
+	var lastTimestamps [2]int32
+
+	// forward sends the event to the action previously registered to the pad.
+	forward := func(pad int, ev midi.MidiEvent) {
+		if singles[pad].Action != nil {
+			singles[pad].Action(ev)
+		}
+	}
+
+	// newAction creates the onPress function of one of the pads.
+	newAction := func(pad int) midiAction {
+		other := 1 - pad
+
+		return func(ev midi.MidiEvent) {
+			if ev.Type != midi.EventNoteOn || ev.Velocity == 0 || (!isStarted && ev.Velocity <= threshold) {
+				forward(pad, ev)
+				return
+			}
+
+			sinceOther := ev.Timestamp - lastTimestamps[other]
+			recentOther := wasHit[other] && sinceOther >= 0
+			wasHit[pad] = true
+			lastTimestamps[pad] = ev.Timestamp
+
+			if isStarted && recentOther && sinceOther <= maxRepeatDelayMs {
+				// Both pads are still being repeated, so keep holding the diagonal.
+				keyAction.Press()
+				keyAction.QueueTimedAction(time.Duration(maxRepeatDelayMs) * time.Millisecond)
+			} else if !isStarted && recentOther && sinceOther <= windowMs {
+				// Both pads were hit together, so start the diagonal.
+				isStarted = true
+				keyAction.Press()
+				keyAction.QueueTimedAction(shortRelease)
+			} else {
+				// Let the pad's own action press its key before the diagonal is released,
+				// so keys shared by both aren't released in between.
+				forward(pad, ev)
+				if isStarted && keyAction.IsPressed() {
+					keyAction.Release()
+				}
+				isStarted = false
+				return
+			}
+
+			kbEv.el.SendMIDIEvent(channel, keys[pad])
+		}
+	}
+
+	// The actions previously registered to the pads are already executed by the diagonal,
+	// so they must be replaced even if new actions are being appended.
+	appendActions := kbEv.appendActions
+	kbEv.appendActions = false
+	defer kbEv.SetAppendActions(appendActions)
+
+	for i, event := range events {
+		single := singles[i]
+
+		// Each pad keeps the label of its own action, since the diagonal is only reported while it's held
+		// (i.e., by the keys that it presses and by the pads that keep it held).
+		register := func() {
+			if single.Register != nil {
+				single.Register()
+			}
+		}
+		stop := func() {
+			isStarted = false
+			if single.Stop != nil {
+				single.Stop()
+			}
+		}
+
+		kbEv.registerStoppableAction(event, newAction(i), register, stop)
+	}
+}
+
+// registeredAction returns the action registered to the event
+// in the set receiving new actions, if any.
+func (kbEv *keyEvents) registeredAction(event noteEvent) (namedMidiAction, bool) {
+	set := kbEv.actions
+	if kbEv.curSet != "" {
+		set = kbEv.namedSets[kbEv.curSet]
+	}
+
+	action, ok := set[event]
+	return action, ok
+}
@@ -0,0 +1,137 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestDiagonalAction(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiUp = 2
+	const midiRight = 3
+	const keyUp = 4
+	const keyRight = 5
+	const windowMs = 30
+	const maxDelayMs = 100
+	const shortRelease = 40 * time.Millisecond
+	const rollDelay = 30 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyUp, keyRight)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterHoldAction(evType, channel, midiUp, keyUp, threshold, maxDelayMs, shortRelease)
+	ke.RegisterHoldAction(evType, channel, midiRight, keyRight, threshold, maxDelayMs, shortRelease)
+	ke.RegisterDiagonalAction(
+		evType,
+		channel,
+		midiUp,
+		midiRight,
+		[]int{keyUp, keyRight},
+		threshold,
+		windowMs,
+		maxDelayMs,
+		shortRelease,
+	)
+
+	// assertUnchanged checks that neither key changed its state.
+	assertUnchanged := func() {
+		select {
+		case <-kc[keyUp].newState:
+			t.Fatalf("UP changed its state")
+		case <-kc[keyRight].newState:
+			t.Fatalf("RIGHT changed its state")
+		default:
+		}
+	}
+
+	// Test that hitting both pads together presses both keys.
+	sendMidiEvent(evType, channel, midiUp, 100, conn)
+	assertKeyStates(t, kc[keyUp], 10*time.Millisecond, true)
+	sendMidiEvent(evType, channel, midiRight, 100, conn)
+	assertKeyStates(t, kc[keyRight], 10*time.Millisecond, true)
+
+	// Test that the keys stay pressed while both pads are repeated.
+	midiKeys := []uint8{midiUp, midiRight}
+	for i := 0; i < 6; i++ {
+		time.Sleep(rollDelay)
+		sendMidiEvent(evType, channel, midiKeys[i&1], 100, conn)
+	}
+	time.Sleep(rollDelay)
+	assertUnchanged()
+
+	// Test that both keys get released once the pads stop being repeated.
+	assertKeyStates(t, kc[keyUp], 2*maxDelayMs*time.Millisecond, false)
+	assertKeyStates(t, kc[keyRight], 10*time.Millisecond, false)
+
+	// Test that hitting a single pad is handled by its own action.
+	time.Sleep(maxDelayMs * time.Millisecond)
+	assertKeyEvent(t, kc, keyRight, evType, channel, midiRight, 100, conn, shortRelease, 10*time.Millisecond)
+	assertUnchanged()
+}
+
+func TestDiagonalActionRegister(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiUp = 2
+	const midiRight = 3
+	const midiLeft = 4
+	keyUp := keyNameToInt["UP"]
+	keyRight := keyNameToInt["RIGHT"]
+	keyLeft := keyNameToInt["LEFT"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyUp, keyRight, keyLeft)
+	defer kc.Close()
+
+	el := registerLogger{event_logger.New(nil), make(chan string, 64)}
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterHoldAction(evType, channel, midiUp, keyUp, 30, 100, 40*time.Millisecond)
+	ke.RegisterHoldAction(evType, channel, midiRight, keyRight, 30, 100, 40*time.Millisecond)
+	ke.RegisterHoldAction(evType, channel, midiLeft, keyLeft, 30, 100, 40*time.Millisecond)
+	ke.RegisterDiagonalAction(evType, channel, midiUp, midiRight, []int{keyUp, keyRight}, 30, 30, 100, 40*time.Millisecond)
+	ke.RegisterDiagonalAction(evType, channel, midiUp, midiLeft, []int{keyUp, keyLeft}, 30, 30, 100, 40*time.Millisecond)
+
+	// Test that each pad keeps its own label, even if it's shared by many diagonals.
+	want := []string{
+		"ch=1 ev=2 key=UP",
+		"ch=1 ev=3 key=RIGHT",
+		"ch=1 ev=4 key=LEFT",
+		"ch=1 ev=2 key=UP",
+		"ch=1 ev=3 key=RIGHT",
+		"ch=1 ev=2 key=UP",
+		"ch=1 ev=4 key=LEFT",
+	}
+	for i, ev := range want {
+		select {
+		case got := <-el.registered:
+			assert(t, got == ev, "register event %d should be '%s', got: '%s'", i, ev, got)
+		default:
+			t.Fatalf("missing register event %d: '%s'", i, ev)
+		}
+	}
+	select {
+	case got := <-el.registered:
+		t.Fatalf("unexpected register event: '%s'", got)
+	default:
+	}
+}
@@ -32,6 +32,44 @@ const (
 	ErrConfigThresholdInvalid
 	// The parsed value was ignored
 	ErrConfigIgnored
+	// The action can't be bound to a Control Change event
+	ErrConfigControlChangeInvalid
+	// The action must be defined inside a named set
+	ErrConfigSetActionOutsideSet
+	// Invalid mapping option
+	ErrConfigOptionInvalid
+	// The variable must be declared (with VAR) before being used
+	ErrConfigVariableUnknown
+	// Failed to load the script, or the script doesn't have the requested function
+	ErrConfigScriptInvalid
+	// The plugin must be declared (with PLUGIN) before being used
+	ErrConfigPluginUnknown
+	// The plugin sent an invalid command
+	ErrPluginCommandInvalid
+	// The action type's name is already used by another action
+	ErrActionTypeExists
+	// The action type must have a name (without spaces) and a constructor returning an action
+	ErrActionTypeInvalid
+	// The JSON config file isn't valid JSON, or doesn't match the expected structure
+	ErrConfigJSONInvalid
+	// A mapping in a JSON config file has an unknown field, is missing a field, or has a field of the wrong type
+	ErrConfigFieldInvalid
+	// The mapping replaces the action of an event that was already mapped in the same set
+	ErrConfigMappingOverridden
+	// The named set is never activated by any mapping
+	ErrConfigSetUnreachable
+	// The named set is activated, but it's never declared
+	ErrConfigSetUnknown
+	// The previous/next/reset event of a REPEAT-SEQUENCE is also mapped to another action
+	ErrConfigSequenceCollision
+	// The threshold is at least 127, so no event may ever trigger the action
+	ErrConfigThresholdUnreachable
+	// The config file includes itself, either directly or through other included files
+	ErrConfigIncludeCycle
+	// The constant must be defined as "define NAME=VALUE", where NAME starts with a letter and isn't an action
+	ErrConfigDefineInvalid
+	// The key events generator was already closed
+	ErrKeyEventsClosed
 )
 
 // Implements the 'error' interface for 'errCode'.
@@ -50,7 +88,7 @@ func (e errCode) Error() string {
 	case ErrConfigEventTokenMissing:
 		return `(key_events) missing token "ev=" for event`
 	case ErrConfigEventInvalid:
-		return `(key_events) invalid event, must be a value between 0 and 255`
+		return `(key_events) invalid event, must be a value between 0 and 255, or the name of a note`
 	case ErrConfigKeyTokenMissing:
 		return `(key_events) missing token "key=" for key`
 	case ErrConfigKeyInvalid:
@@ -65,6 +103,44 @@ func (e errCode) Error() string {
 		return "(key_events) invalid event, must be a value between 0 and 255"
 	case ErrConfigIgnored:
 		return "(key_events) the parsed value was ignored"
+	case ErrConfigControlChangeInvalid:
+		return `(key_events) the action can't be bound to a Control Change event ("cc=")`
+	case ErrConfigSetActionOutsideSet:
+		return "(key_events) the action must be defined inside a named set"
+	case ErrConfigOptionInvalid:
+		return `(key_events) invalid mapping option (e.g., "hold=" must be a duration in milliseconds, and "if=" a valid condition)`
+	case ErrConfigVariableUnknown:
+		return "(key_events) the variable must be declared (with VAR) before being used"
+	case ErrConfigScriptInvalid:
+		return "(key_events) failed to load the script, or the script doesn't have the requested function"
+	case ErrConfigPluginUnknown:
+		return "(key_events) the plugin must be declared (with PLUGIN) before being used"
+	case ErrPluginCommandInvalid:
+		return `(key_events) invalid plugin command, must be one of "press", "release", "tap" (with "ms") or "use" (with "set")`
+	case ErrActionTypeExists:
+		return "(key_events) the action type's name is already used by another action"
+	case ErrActionTypeInvalid:
+		return "(key_events) the action type must have a name (without spaces) and a constructor returning an action"
+	case ErrConfigJSONInvalid:
+		return "(key_events) the JSON config file is invalid, or it doesn't match the expected structure"
+	case ErrConfigFieldInvalid:
+		return "(key_events) the mapping has an unknown field, is missing a required field, or has a field of the wrong type"
+	case ErrConfigMappingOverridden:
+		return "(key_events) the mapping replaces the action of an event already mapped in the same set"
+	case ErrConfigSetUnreachable:
+		return "(key_events) the named set is never activated by any mapping"
+	case ErrConfigSetUnknown:
+		return "(key_events) the named set is activated, but it's never declared"
+	case ErrConfigSequenceCollision:
+		return "(key_events) the event controlling a REPEAT-SEQUENCE is also mapped to another action"
+	case ErrConfigThresholdUnreachable:
+		return "(key_events) the threshold is at least 127, so the action is never triggered"
+	case ErrConfigIncludeCycle:
+		return "(key_events) the config file includes itself, either directly or through other included files"
+	case ErrConfigDefineInvalid:
+		return `(key_events) invalid constant, must be defined as "define NAME=VALUE"`
+	case ErrKeyEventsClosed:
+		return "(key_events) the key events generator was already closed"
 	default:
 		return "(key_events) unknown error"
 	}
@@ -0,0 +1,156 @@
+package key_events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// shellCommand converts command into the arguments used to run it in the system's shell.
+func shellCommand(command []string) []string {
+	line := strings.Join(command, " ")
+
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", line}
+	}
+	return []string{"sh", "-c", line}
+}
+
+// splitCommand splits a command line into its arguments, separated by spaces.
+// Spaces may be kept in an argument by quoting them, with either ' or ",
+// or by escaping them with '\' (which escapes any character, except within single quotes).
+// If a quote isn't closed, or if the line ends with '\', the line is invalid.
+func splitCommand(line string) ([]string, bool) {
+	var args []string
+	var arg strings.Builder
+	// Whether an argument was started, so quoted empty arguments are kept.
+	var inArg bool
+	// The quote that started the current quoted text, if any.
+	var quote rune
+	var escaped bool
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, false
+	} else if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, true
+}
+
+// runCommand runs the command, killing it if it doesn't finish within timeout
+// (or once ctx is canceled).
+// The MIDI event that triggered the command is passed in its environment,
+// as MIDI_CHANNEL, MIDI_KEY, MIDI_VELOCITY and MIDI_TIMESTAMP.
+func runCommand(ctx context.Context, command []string, timeout time.Duration, ev midi.MidiEvent) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(
+		os.Environ(),
+		fmt.Sprintf("MIDI_CHANNEL=%d", ev.Channel),
+		fmt.Sprintf("MIDI_KEY=%d", ev.Key),
+		fmt.Sprintf("MIDI_VELOCITY=%d", ev.Velocity),
+		fmt.Sprintf("MIDI_TIMESTAMP=%d", ev.Timestamp),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("exec: '%s' timed out after %s", command[0], timeout)
+	} else if ctx.Err() == context.Canceled {
+		log.Printf("exec: killed '%s', since its mappings were closed", command[0])
+	} else if err != nil {
+		log.Printf("exec: '%s' failed: %+v - output: %s", command[0], err, out)
+	}
+}
+
+func (kbEv *keyEvents) RegisterExecAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	timeout time.Duration,
+	maxRunning int,
+	useShell bool,
+	command []string,
+) error {
+	if timeout <= 0 || maxRunning <= 0 || len(command) == 0 {
+		return ErrConfigActionArgumentInvalid
+	}
+
+	event := generateNoteEvent(evType, channel, key)
+
+	kbEv.removeAction(event)
+
+	if useShell {
+		command = shellCommand(command)
+	}
+
+	// Limits how many instances of the command may be running at once.
+	running := make(chan struct{}, maxRunning)
+
+	// Kill every instance still running once the mappings are replaced (or closed).
+	ctx, cancel := context.WithCancel(context.Background())
+	kbEv.closeActions = append(kbEv.closeActions, func() { cancel() })
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		select {
+		case running <- struct{}{}:
+		default:
+			log.Printf("exec: skipping '%s', already running %d time(s)", command[0], maxRunning)
+			return
+		}
+
+		// Run the command in the background,
+		// so it doesn't block the following events.
+		go func() {
+			runCommand(ctx, command, timeout, ev)
+			<-running
+		}()
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "EXEC") }
+	kbEv.registerAction(event, action, register)
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// waitForFile waits until the file in path has at least one line,
+// returning its content.
+func waitForFile(t *testing.T, path string, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(path)
+		if err == nil && strings.HasSuffix(string(data), "\n") {
+			return string(data)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("file '%s' wasn't written in time", path)
+	return ""
+}
+
+func TestExecAction(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const threshold = 30
+
+	out := filepath.Join(t.TempDir(), "out.txt")
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController()
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// Test that commands that could never run are rejected.
+	err = ke.RegisterExecAction(evType, channel, midiKey, threshold, time.Second, 0, true, []string{"true"})
+	assert(t, errors.Is(err, ErrConfigActionArgumentInvalid), "expected maxRunning=0 to fail, got: %+v", err)
+	err = ke.RegisterExecAction(evType, channel, midiKey, threshold, 0, 1, true, []string{"true"})
+	assert(t, errors.Is(err, ErrConfigActionArgumentInvalid), "expected timeout=0 to fail, got: %+v", err)
+
+	err = ke.RegisterExecAction(
+		evType,
+		channel,
+		midiKey,
+		threshold,
+		time.Second,
+		1,
+		true,
+		[]string{`echo "$MIDI_CHANNEL $MIDI_KEY $MIDI_VELOCITY" >>`, out},
+	)
+	assert(t, err == nil, "Failed to register the command: %+v", err)
+
+	// Test that events bellow the threshold are ignored.
+	sendMidiEvent(evType, channel, midiKey, threshold, conn)
+	time.Sleep(50 * time.Millisecond)
+	_, err = os.Stat(out)
+	assert(t, os.IsNotExist(err), "command was run by an event bellow the threshold")
+
+	// Test that the event is passed to the command.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	got := waitForFile(t, out, time.Second)
+	assert(t, got == "1 2 100\n", "invalid command output: '%s'", got)
+}
+
+func TestExecActionLimit(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const threshold = 30
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	killed := filepath.Join(dir, "killed.txt")
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController()
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	err = ke.RegisterExecAction(
+		evType,
+		channel,
+		midiKey,
+		threshold,
+		time.Second,
+		1,
+		true,
+		[]string{"sleep 0.2; echo $MIDI_VELOCITY >>", out},
+	)
+	assert(t, err == nil, "Failed to register the command: %+v", err)
+	err = ke.RegisterExecAction(
+		evType,
+		channel,
+		midiKey+1,
+		threshold,
+		50*time.Millisecond,
+		1,
+		false,
+		[]string{"sh", "-c", "sleep 1; echo done > " + killed},
+	)
+	assert(t, err == nil, "Failed to register the command: %+v", err)
+
+	// Test that the second event is dropped while the first command is running.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	sendMidiEvent(evType, channel, midiKey, 101, conn)
+	time.Sleep(400 * time.Millisecond)
+	got := waitForFile(t, out, time.Second)
+	assert(t, got == "100\n", "invalid command output: '%s'", got)
+
+	// Test that the command is killed after its timeout.
+	sendMidiEvent(evType, channel, midiKey+1, 100, conn)
+	time.Sleep(1500 * time.Millisecond)
+	_, err = os.Stat(killed)
+	assert(t, os.IsNotExist(err), "command wasn't killed after its timeout")
+}
+
+func TestSplitCommand(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want []string
+	}{
+		{"notify-send  a\tb", []string{"notify-send", "a", "b"}},
+		{`notify-send "a  b" 'c "d"' e\ f`, []string{"notify-send", "a  b", `c "d"`, "e f"}},
+		{`printf '%s\n' "" x`, []string{"printf", `%s\n`, "", "x"}},
+		{`a"b c"d`, []string{"ab cd"}},
+	} {
+		got, ok := splitCommand(tc.line)
+		assert(t, ok, "'%s' should be valid", tc.line)
+		assert(t, strings.Join(got, "|") == strings.Join(tc.want, "|") && len(got) == len(tc.want),
+			"'%s' should be split into %q, got: %q", tc.line, tc.want, got)
+	}
+
+	for _, line := range []string{`a "b`, `a 'b`, `a\`} {
+		_, ok := splitCommand(line)
+		assert(t, !ok, "'%s' should be invalid", line)
+	}
+}
+
+func TestExecConfig(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	const evType = midi.EventNoteOn
+	const channel = 9
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in put.txt")
+	err := os.WriteFile(in, []byte("copied\n"), 0644)
+	assert(t, err == nil, "Failed to write the input: %+v", err)
+	copied := filepath.Join(dir, "copied.txt")
+	shell := filepath.Join(dir, "shell.txt")
+	killed := filepath.Join(dir, "killed.txt")
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController()
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	config := []string{
+		`ch=9 ev=0x24 key=NONE thres=30 EXEC 1000 1 str=cp "` + in + `" ` + copied,
+		`ch=9 ev=0x25 key=NONE thres=30 EXEC-SHELL 1000 1 str=printf '%s\n' "a  b" > ` + shell,
+		`ch=9 ev=0x26 key=NONE thres=30 EXEC-SHELL 5000 1 str=sleep 0.5; echo done > ` + killed,
+		`ch=9 ev=0x27 key=NONE thres=30 EXEC 1000 1 str=echo "a`,
+	}
+	path := filepath.Join(dir, "config.txt")
+	err = os.WriteFile(path, []byte(strings.Join(config, "\n")+"\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	// Test that commands with unclosed quotes are rejected.
+	err = ke.ReadConfig(path)
+	var configErr *ConfigError
+	assert(t, errors.As(err, &configErr), "expected a ConfigError, got: %+v", err)
+	assert(t, len(configErr.Problems) == 1 && configErr.Problems[0].Line == 4, "expected a single problem in line 4, got: %+v", err)
+	assert(t, errors.Is(configErr.Problems[0].Err, ErrConfigActionArgumentInvalid), "expected an invalid argument, got: %+v", err)
+
+	// Test that quoted arguments may have spaces.
+	sendMidiEvent(evType, channel, 0x24, 100, conn)
+	got := waitForFile(t, copied, time.Second)
+	assert(t, got == "copied\n", "invalid command output: '%s'", got)
+
+	// Test that shell commands are run exactly as written.
+	sendMidiEvent(evType, channel, 0x25, 100, conn)
+	got = waitForFile(t, shell, time.Second)
+	assert(t, got == "a  b\n", "invalid command output: '%s'", got)
+
+	// Test that running commands are killed once the mappings are closed.
+	sendMidiEvent(evType, channel, 0x26, 100, conn)
+	time.Sleep(100 * time.Millisecond)
+	err = ke.Close()
+	assert(t, err == nil, "Failed to close the key event generator: %+v", err)
+	time.Sleep(time.Second)
+	_, err = os.Stat(killed)
+	assert(t, os.IsNotExist(err), "command wasn't killed once the mappings were closed")
+}
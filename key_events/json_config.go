@@ -0,0 +1,718 @@
+package key_events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SirGFM/midi-go-key/err_wrap"
+)
+
+// A named parameter of an action, in JSON config files.
+type actionParam struct {
+	// The parameter's field name.
+	name string
+	// The kind of value expected by the parameter.
+	kind ArgKind
+	// The fields making up the parameter, if it's a string argument made of many values
+	// (e.g., "NAME,VALUE" for VAR-SET), in which case name isn't used.
+	fields []paramField
+	// The separator between the fields, in text config files.
+	sep string
+}
+
+// The kind of value expected by a paramField.
+type fieldKind int
+
+const (
+	// A name (e.g., of a variable), which can't have any separator nor spaces.
+	fieldName fieldKind = iota
+	// A decimal integer.
+	fieldInt
+	// One or more keys, either as a list or as a single string.
+	fieldKeys
+	// A boolean, written as its only choice if it's true (and omitted otherwise).
+	fieldFlag
+	// One of the choices, in any case.
+	fieldChoice
+)
+
+// A named field of an argument made of many values, in JSON config files.
+type paramField struct {
+	// The field's name.
+	name string
+	// The kind of value expected by the field.
+	kind fieldKind
+	// Whether the field may be omitted. Only the last fields of an argument may be optional.
+	optional bool
+	// The values accepted by fieldChoice fields, or the text written by fieldFlag fields.
+	choices []string
+}
+
+// The modes of SOCD groups and of layers, in text config files.
+var (
+	socdModes  = []string{"LAST", "FIRST", "NEUTRAL"}
+	layerModes = []string{"TRANSPARENT", "OPAQUE"}
+)
+
+// List the named parameters of each action, in the order of their arguments in text config files.
+var actionParams = map[string][]actionParam{
+	"BASIC":    {{name: "release_ms", kind: ArgInt}},
+	"VELOCITY": {{name: "min_ms", kind: ArgInt}, {name: "max_ms", kind: ArgInt}},
+	"TOGGLE":   {{name: "toggle_thres", kind: ArgInt}, {name: "quick_press_ms", kind: ArgInt}},
+	"REPEAT":   {{name: "repeat_ms", kind: ArgInt}, {name: "short_release_ms", kind: ArgInt}},
+	"REPEAT-SEQUENCE": {
+		{name: "repeat_ms", kind: ArgInt},
+		{name: "short_release_ms", kind: ArgInt},
+		{name: "prev_ev", kind: ArgInt},
+		{name: "next_ev", kind: ArgInt},
+		{name: "reset_ev", kind: ArgInt},
+		{name: "keys", kind: ArgString},
+	},
+	"DIAGONAL": {
+		{name: "other_ev", kind: ArgInt},
+		{name: "window_ms", kind: ArgInt},
+		{name: "repeat_ms", kind: ArgInt},
+		{name: "short_release_ms", kind: ArgInt},
+		{name: "keys", kind: ArgString},
+	},
+	"USE-MAPPING": {{name: "sets", kind: ArgString}},
+	"NEW-MAPPING": {{name: "name", kind: ArgString}},
+	"EXEC": {
+		{name: "timeout_ms", kind: ArgInt},
+		{name: "max_running", kind: ArgInt},
+		{name: "command", kind: ArgString},
+	},
+	"EXEC-SHELL": {
+		{name: "timeout_ms", kind: ArgInt},
+		{name: "max_running", kind: ArgInt},
+		{name: "command", kind: ArgString},
+	},
+	"WEBHOOK":        {{name: "timeout_ms", kind: ArgInt}, {name: "request", kind: ArgString}},
+	"TURBO":          {{name: "min_period_ms", kind: ArgInt}, {name: "max_period_ms", kind: ArgInt}},
+	"HOLD-MAPPING":   {{name: "set", kind: ArgString}},
+	"SELECT-MAPPING": {{name: "set", kind: ArgString}},
+	"PREV-MAPPING":   {{name: "sets", kind: ArgString}},
+	"LAST-MAPPING":   {},
+	"NEW-LAYER": {{kind: ArgString, sep: ",", fields: []paramField{
+		{name: "name", kind: fieldName},
+		{name: "mode", kind: fieldChoice, optional: true, choices: layerModes},
+	}}},
+	"ON-ENTER": {{name: "release_ms", kind: ArgInt}},
+	"ON-EXIT":  {{name: "release_ms", kind: ArgInt}},
+	"PANIC":    {},
+	"SOCD": {{kind: ArgString, sep: ",", fields: []paramField{
+		{name: "keys", kind: fieldKeys},
+		{name: "mode", kind: fieldChoice, optional: true, choices: socdModes},
+	}}},
+	"VAR": {{kind: ArgString, sep: ",", fields: []paramField{
+		{name: "name", kind: fieldName},
+		{name: "min", kind: fieldInt},
+		{name: "max", kind: fieldInt},
+	}}},
+	"VAR-SET": {{kind: ArgString, sep: ",", fields: []paramField{
+		{name: "name", kind: fieldName},
+		{name: "value", kind: fieldInt},
+	}}},
+	"VAR-INC": {{kind: ArgString, sep: ",", fields: []paramField{
+		{name: "name", kind: fieldName},
+		{name: "wrap", kind: fieldFlag, optional: true, choices: []string{"WRAP"}},
+	}}},
+	"VAR-DEC": {{kind: ArgString, sep: ",", fields: []paramField{
+		{name: "name", kind: fieldName},
+		{name: "wrap", kind: fieldFlag, optional: true, choices: []string{"WRAP"}},
+	}}},
+	"VAR-KEY": {
+		{name: "release_ms", kind: ArgInt},
+		{kind: ArgString, sep: ":", fields: []paramField{
+			{name: "name", kind: fieldName},
+			{name: "keys", kind: fieldKeys},
+		}},
+	},
+	"SCRIPT":       {{name: "function", kind: ArgString}},
+	"PLUGIN":       {{name: "plugin", kind: ArgString}},
+	"PLUGIN-EVENT": {{name: "plugin", kind: ArgString}},
+}
+
+// hasField checks whether the parameter is (or is made of) the named field.
+func (param actionParam) hasField(name string) bool {
+	if param.fields == nil {
+		return param.name == name
+	}
+
+	for _, field := range param.fields {
+		if field.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isChoice checks whether text is one of the field's choices, in any case.
+func (field paramField) isChoice(text string) bool {
+	for _, choice := range field.choices {
+		if strings.EqualFold(text, choice) {
+			return true
+		}
+	}
+	return false
+}
+
+// text converts the field's value into its text in config lines,
+// or into an empty string if it's omitted (i.e., value is nil or a false flag).
+// next is the field following this one in the argument, if any.
+func (field paramField) text(value interface{}, next *paramField) (string, error) {
+	if value == nil && field.optional {
+		return "", nil
+	} else if value == nil {
+		return "", badField(field.name)
+	}
+
+	var text string
+	switch field.kind {
+	case fieldName:
+		name, ok := value.(string)
+		if !ok || name == "" || strings.ContainsAny(name, " \t,:;") {
+			return "", badField(field.name)
+		}
+		text = name
+	case fieldInt:
+		number, ok := value.(json.Number)
+		if !ok {
+			return "", badField(field.name)
+		} else if _, err := strconv.Atoi(number.String()); err != nil {
+			return "", badField(field.name)
+		}
+		text = number.String()
+	case fieldKeys:
+		keys, ok := jsonToken(value)
+		if !ok || keys == "" || strings.ContainsAny(keys, " \t") {
+			return "", badField(field.name)
+		}
+
+		// Modes must be set in their own field, instead of being listed alongside the keys.
+		items := strings.Split(keys, ",")
+		if next != nil && next.isChoice(items[len(items)-1]) {
+			return "", badField(field.name)
+		}
+		text = keys
+	case fieldFlag:
+		flag, ok := value.(bool)
+		if !ok {
+			return "", badField(field.name)
+		} else if flag {
+			text = field.choices[0]
+		}
+	case fieldChoice:
+		choice, ok := value.(string)
+		if !ok || !field.isChoice(choice) {
+			return "", badField(field.name)
+		}
+		text = choice
+	}
+
+	return text, nil
+}
+
+// joinFields converts the fields of the parameter in mapping into the text of its argument.
+func (param actionParam) joinFields(mapping jsonMapping) (string, error) {
+	var parts []string
+	for i, field := range param.fields {
+		var next *paramField
+		if i+1 < len(param.fields) {
+			next = &param.fields[i+1]
+		}
+
+		text, err := field.text(mapping[field.name], next)
+		if err != nil {
+			return "", err
+		} else if text != "" {
+			parts = append(parts, text)
+		}
+	}
+
+	return strings.Join(parts, param.sep), nil
+}
+
+// splitFields splits the text of the parameter's argument into the value of each of its fields,
+// omitting the optional fields that aren't set.
+// Fields with keys take every value not taken by the other fields.
+func (param actionParam) splitFields(text string) (orderedObject, bool) {
+	parts := strings.Split(text, param.sep)
+	fields := param.fields
+
+	// Match the optional fields from the end of the argument.
+	var optional orderedObject
+	for len(fields) > 0 && fields[len(fields)-1].optional {
+		field := fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+		if len(parts) == 0 || !field.isChoice(parts[len(parts)-1]) {
+			continue
+		}
+
+		var value interface{} = parts[len(parts)-1]
+		if field.kind == fieldFlag {
+			value = true
+		}
+		optional = append(orderedObject{{name: field.name, value: value}}, optional...)
+		parts = parts[:len(parts)-1]
+	}
+
+	var obj orderedObject
+	for i, field := range fields {
+		switch {
+		case field.kind == fieldKeys && len(parts) > len(fields)-i:
+			count := len(parts) - (len(fields) - i - 1)
+			var keys []string
+			keys, parts = parts[:count], parts[count:]
+			obj.set(field.name, keys)
+		case len(parts) == 0:
+			return nil, false
+		case field.kind == fieldInt:
+			value, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil, false
+			}
+			obj.set(field.name, json.Number(strconv.Itoa(value)))
+			parts = parts[1:]
+		default:
+			obj.set(field.name, parts[0])
+			parts = parts[1:]
+		}
+	}
+	if len(parts) > 0 {
+		return nil, false
+	}
+
+	return append(obj, optional...), true
+}
+
+// List the actions that don't use their MIDI event (e.g., declarations),
+// so their mappings may omit "ev".
+var actionsWithoutEvent = map[string]bool{
+	"NEW-MAPPING": true,
+	"NEW-LAYER":   true,
+	"ON-ENTER":    true,
+	"ON-EXIT":     true,
+	"SOCD":        true,
+	"VAR":         true,
+	"PLUGIN":      true,
+}
+
+// List the fields accepted by every mapping, besides the named parameters of its action.
+var mappingFields = map[string]bool{
+	"comment": true,
+	"append":  true,
+	"ch":      true,
+	"ev":      true,
+	"cc":      true,
+	"key":     true,
+	"thres":   true,
+	"hold":    true,
+	"if":      true,
+	"action":  true,
+}
+
+// The values used by mappings that omit some of their fields.
+type jsonDefaults struct {
+	Channel   interface{} `json:"ch"`
+	Threshold interface{} `json:"thres"`
+	Hold      interface{} `json:"hold"`
+}
+
+// merge returns the defaults, overridden by every value set in other.
+func (defaults jsonDefaults) merge(other jsonDefaults) jsonDefaults {
+	if other.Channel != nil {
+		defaults.Channel = other.Channel
+	}
+	if other.Threshold != nil {
+		defaults.Threshold = other.Threshold
+	}
+	if other.Hold != nil {
+		defaults.Hold = other.Hold
+	}
+
+	return defaults
+}
+
+// A single mapping, whose fields are named after the tokens of text config files
+// (e.g., "ch", "ev" and "key"), plus "action" and the named parameters of the action.
+// Custom actions list their arguments, in order, in "args".
+type jsonMapping map[string]interface{}
+
+// A named set (or layer), and its mappings.
+type jsonSet struct {
+	Comment  interface{}   `json:"comment"`
+	Name     string        `json:"name"`
+	Layer    bool          `json:"layer"`
+	Opaque   bool          `json:"opaque"`
+	Defaults jsonDefaults  `json:"defaults"`
+	Include  []string      `json:"include"`
+	Mappings []jsonMapping `json:"mappings"`
+}
+
+// A JSON config file.
+type jsonConfig struct {
+	Comment  interface{}            `json:"comment"`
+	Define   map[string]interface{} `json:"define"`
+	Defaults jsonDefaults           `json:"defaults"`
+	Include  []string               `json:"include"`
+	Mappings []jsonMapping          `json:"mappings"`
+	Sets     []jsonSet              `json:"sets"`
+}
+
+// jsonToken converts a field's value into its text in config lines,
+// joining lists with commas.
+func jsonToken(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String(), true
+	case string:
+		return v, true
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			if _, isList := item.([]interface{}); isList {
+				return "", false
+			}
+
+			text, ok := jsonToken(item)
+			if !ok {
+				return "", false
+			}
+			items = append(items, text)
+		}
+		return strings.Join(items, ","), true
+	default:
+		return "", false
+	}
+}
+
+// badField reports that the field made the mapping invalid.
+func badField(name string) error {
+	return badToken(name, ErrConfigFieldInvalid)
+}
+
+// included returns the file included by the mapping, if it's an include (i.e., {"include": PATH}),
+// which may only have a comment besides the included file.
+func (mapping jsonMapping) included() (string, bool, error) {
+	value, ok := mapping["include"]
+	if !ok {
+		return "", false, nil
+	}
+
+	include, isString := value.(string)
+	if !isString || include == "" {
+		return "", true, badField("include")
+	}
+	for name := range mapping {
+		if name != "include" && name != "comment" {
+			return "", true, badField(name)
+		}
+	}
+
+	return include, true, nil
+}
+
+// line converts the mapping into the equivalent line of a text config file,
+// so both formats are parsed (and registered) in exactly the same way.
+func (mapping jsonMapping) line(defaults jsonDefaults) (string, error) {
+	action, ok := mapping["action"].(string)
+	if !ok {
+		return "", badField("action")
+	}
+
+	// List the values of the action's arguments, in order, and the field of each of them.
+	var kinds []ArgKind
+	var values []interface{}
+	var fields []string
+	if params, ok := actionParams[action]; ok {
+		for _, param := range params {
+			if param.fields != nil {
+				text, err := param.joinFields(mapping)
+				if err != nil {
+					return "", err
+				}
+				kinds = append(kinds, param.kind)
+				values = append(values, text)
+				fields = append(fields, param.fields[0].name)
+				continue
+			}
+
+			value, ok := mapping[param.name]
+			if !ok {
+				return "", badField(param.name)
+			}
+			kinds = append(kinds, param.kind)
+			values = append(values, value)
+			fields = append(fields, param.name)
+		}
+	} else if customType, ok := lookupActionType(action); ok {
+		args, ok := mapping["args"].([]interface{})
+		if !ok || len(args) != len(customType.args) {
+			return "", badField("args")
+		}
+		kinds = customType.args
+		values = args
+		for range args {
+			fields = append(fields, "args")
+		}
+	} else {
+		return "", badToken(action, ErrConfigActionInvalid)
+	}
+
+	_, isBuiltIn := actionParams[action]
+	for name := range mapping {
+		if mappingFields[name] || (name == "args" && !isBuiltIn) {
+			continue
+		}
+
+		var isParam bool
+		for _, param := range actionParams[action] {
+			isParam = isParam || param.hasField(name)
+		}
+		if !isParam {
+			return "", badField(name)
+		}
+	}
+
+	// field returns the text of the field, or of its default if it's omitted,
+	// or an empty string if neither was set.
+	field := func(name string, fallback interface{}) (string, error) {
+		value, ok := mapping[name]
+		if !ok {
+			value = fallback
+		}
+		if value == nil {
+			return "", nil
+		}
+
+		text, ok := jsonToken(value)
+		if !ok || text == "" || strings.ContainsAny(text, " \t") {
+			return "", badField(name)
+		}
+		return text, nil
+	}
+
+	var args []string
+
+	ch, err := field("ch", defaults.Channel)
+	if err != nil {
+		return "", err
+	} else if ch == "" {
+		ch = "0"
+	}
+	args = append(args, "ch="+ch)
+
+	if _, ok := mapping["cc"]; ok {
+		cc, err := field("cc", nil)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "cc="+cc)
+	} else {
+		ev, err := field("ev", nil)
+		if err != nil {
+			return "", err
+		} else if ev == "" && !actionsWithoutEvent[action] {
+			return "", badField("ev")
+		} else if ev == "" {
+			ev = "0"
+		}
+		args = append(args, "ev="+ev)
+	}
+
+	key, err := field("key", nil)
+	if err != nil {
+		return "", err
+	} else if key == "" {
+		key = "NONE"
+	}
+	args = append(args, "key="+key)
+
+	thres, err := field("thres", defaults.Threshold)
+	if err != nil {
+		return "", err
+	} else if thres == "" {
+		thres = "0"
+	}
+	args = append(args, "thres="+thres)
+
+	hold, err := field("hold", defaults.Hold)
+	if err != nil {
+		return "", err
+	} else if hold != "" {
+		args = append(args, "hold="+hold)
+	}
+
+	// The condition may either be a single string or a list of conditions.
+	var conditions []interface{}
+	switch value := mapping["if"].(type) {
+	case nil:
+	case string:
+		conditions = []interface{}{value}
+	case []interface{}:
+		conditions = value
+	default:
+		return "", badField("if")
+	}
+	for _, value := range conditions {
+		condition, ok := value.(string)
+		if !ok || condition == "" || strings.ContainsAny(condition, " \t") {
+			return "", badField("if")
+		}
+		args = append(args, "if="+condition)
+	}
+
+	args = append(args, action)
+
+	// Only the last argument may have spaces, since it extends to the end of the line.
+	for i, value := range values {
+		text, ok := jsonToken(value)
+		if !ok || (i < len(values)-1 && strings.ContainsAny(text, " \t")) {
+			return "", badField(fields[i])
+		}
+
+		if kinds[i] == ArgString {
+			text = "str=" + text
+		} else if strings.HasPrefix(text, "str=") || strings.ContainsAny(text, " \t") {
+			return "", badField(fields[i])
+		}
+		args = append(args, text)
+	}
+
+	line := strings.Join(args, " ")
+
+	switch value := mapping["append"].(type) {
+	case nil:
+	case bool:
+		if value {
+			line = "+" + line
+		}
+	default:
+		return "", badField("append")
+	}
+
+	return line, nil
+}
+
+// readJSONConfig reads a JSON config file, parsing each of its mappings as the equivalent config line
+// and recording every problem in state.
+// Mappings outside of any set are parsed first, followed by each set (and its mappings), in order.
+func (kbEv *keyEvents) readJSONConfig(state *configState, path string) {
+	state.file, state.line, state.mapping = path, 0, ""
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		state.report(err_wrap.Wrap(err, ErrOpenConfig))
+		return
+	}
+
+	var config jsonConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		state.line = jsonErrorLine(data, err)
+		state.report(err_wrap.Wrap(err, ErrConfigJSONInvalid))
+		return
+	}
+
+	// Define every constant before anything else, so every mapping (and included file) may use them.
+	var names []string
+	for name := range config.Define {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state.mapping = "define." + name
+		kbEv.location = path + ":" + state.mapping
+
+		value, ok := jsonToken(config.Define[name])
+		var err error
+		if !ok {
+			err = badToken(name, ErrConfigDefineInvalid)
+		} else {
+			err = state.define(name + "=" + value)
+		}
+		if err != nil {
+			state.report(err)
+		}
+	}
+
+	// includeFiles reads every included file, before the mappings that follow them.
+	includeFiles := func(list string, includes []string) {
+		for i, include := range includes {
+			state.mapping = fmt.Sprintf("%s[%d]", list, i)
+			kbEv.location = path + ":" + state.mapping
+
+			if err := kbEv.includeConfig(state, path, include); err != nil {
+				state.report(err)
+			}
+		}
+	}
+
+	// parseMappings parses every mapping in the list (and reads every file included among them),
+	// identifying them in warnings and problems by their index in the list.
+	parseMappings := func(list string, mappings []jsonMapping, defaults jsonDefaults) {
+		for i, mapping := range mappings {
+			state.mapping = fmt.Sprintf("%s[%d]", list, i)
+			kbEv.location = path + ":" + state.mapping
+
+			if include, ok, err := mapping.included(); ok {
+				if err == nil {
+					err = kbEv.includeConfig(state, path, include)
+				}
+				if err != nil {
+					state.report(err)
+				}
+				continue
+			}
+
+			line, err := mapping.line(defaults)
+			if err == nil {
+				err = kbEv.parseLine(state, path, line)
+			}
+			if err != nil {
+				state.report(err)
+			}
+		}
+	}
+
+	includeFiles("include", config.Include)
+	parseMappings("mappings", config.Mappings, config.Defaults)
+
+	for i, set := range config.Sets {
+		state.mapping = fmt.Sprintf("sets[%d]", i)
+		kbEv.location = path + ":" + state.mapping
+
+		line := "ch=0 ev=0 key=NONE thres=0 NEW-MAPPING str=" + set.Name
+		if set.Opaque {
+			line = "ch=0 ev=0 key=NONE thres=0 NEW-LAYER str=" + set.Name + ",OPAQUE"
+		} else if set.Layer {
+			line = "ch=0 ev=0 key=NONE thres=0 NEW-LAYER str=" + set.Name
+		}
+
+		// Skip the mappings of invalid sets, since they would otherwise be added to the previous set.
+		var err error
+		if set.Name == "" || strings.ContainsAny(set.Name, " \t,") {
+			err = badField("name")
+		} else if set.Opaque && !set.Layer {
+			err = badField("opaque")
+		} else {
+			err = kbEv.parseLine(state, path, line)
+		}
+		if err != nil {
+			state.report(err)
+			continue
+		}
+
+		includeFiles(fmt.Sprintf("sets[%d].include", i), set.Include)
+		list := fmt.Sprintf("sets[%d].mappings", i)
+		parseMappings(list, set.Mappings, config.Defaults.merge(set.Defaults))
+	}
+}
@@ -0,0 +1,155 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestActionParams(t *testing.T) {
+	for action, count := range actionsToArgCount {
+		params, ok := actionParams[action]
+		assert(t, ok, "action %s doesn't have named parameters", action)
+		assert(t, len(params) == count, "action %s should have %d named parameters, got %d", action, count, len(params))
+	}
+	for action := range actionParams {
+		_, ok := actionsToArgCount[action]
+		assert(t, ok, "named parameters for unknown action %s", action)
+	}
+}
+
+func TestJSONConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// readConfig writes the config to a JSON file and reads it.
+	readConfig := func(config string) error {
+		path := filepath.Join(t.TempDir(), "config.json")
+		err := os.WriteFile(path, []byte(config), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+
+		return ke.ReadConfig(path)
+	}
+
+	err = readConfig(`{
+		"defaults": {"ch": 9, "thres": 30},
+		"mappings": [
+			{"ev": "0x24", "key": "A", "action": "BASIC", "release_ms": 20},
+			{"ev": 40, "action": "USE-MAPPING", "sets": ["SET_A", "SET_B"]}
+		],
+		"sets": [
+			{
+				"name": "SET_A",
+				"defaults": {"thres": 60},
+				"mappings": [
+					{"ev": "0x26", "key": "B", "action": "BASIC", "release_ms": 20}
+				]
+			}
+		]
+	}`)
+	assert(t, err == nil, "Failed to read the config: %+v", err)
+
+	// Test the mapping outside of any set.
+	sendMidiEvent(evType, channel, 0x24, 100, conn)
+	assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+
+	// Test that the set is initially active, and that it uses its own defaults.
+	sendMidiEvent(evType, channel, 0x26, 50, conn)
+	assertKeyStates(t, kc[keyB], 0)
+	sendMidiEvent(evType, channel, 0x26, 100, conn)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+
+	// Test that invalid configs are rejected.
+	for _, tc := range []struct {
+		config string
+		err    error
+	}{
+		{`{"mappings": [`, ErrConfigJSONInvalid},
+		{`{"mapings": []}`, ErrConfigJSONInvalid},
+		{`{"mappings": [{"ev": 1, "key": "A", "action": "BASIC"}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"ev": 1, "key": "A", "action": "BASIC", "release_ms": 20, "foo": 1}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"key": "A", "action": "BASIC", "release_ms": 20}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"ev": "1 key=A", "action": "BASIC", "release_ms": 20}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"ev": 1, "key": "A", "action": "NOT-AN-ACTION"}]}`, ErrConfigActionInvalid},
+		{`{"mappings": [{"ev": 1, "key": "NOT-A-KEY", "action": "BASIC", "release_ms": 20}]}`, ErrConfigKeyInvalid},
+		{`{"sets": [{"name": "SET_C", "opaque": true}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"include": "kit.txt", "key": "A"}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"include": ["kit.txt"]}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"action": "VAR", "var": "SLOT,1,9"}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"action": "VAR", "name": "SLOT", "min": 1, "max": "9"}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"action": "VAR", "name": "SLOT,1", "min": 1, "max": 9}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"ev": 1, "action": "VAR-SET", "name": "SLOT", "value": 1.5}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"ev": 1, "action": "VAR-INC", "name": "SLOT", "wrap": "WRAP"}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"action": "SOCD", "keys": ["LEFT", "RIGHT", "LAST"]}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"action": "SOCD", "keys": ["LEFT", "RIGHT"], "mode": "SIDEWAYS"}]}`, ErrConfigFieldInvalid},
+		{`{"mappings": [{"action": "NEW-LAYER", "name": "LAYER", "mode": ""}]}`, ErrConfigFieldInvalid},
+	} {
+		err := readConfig(tc.config)
+		assert(t, errors.Is(err, tc.err), "config '%s' should fail with '%+v', got: %+v", tc.config, tc.err, err)
+	}
+}
+
+func TestJSONConfigFields(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// Test that arguments made of many values are set by their own fields.
+	path := filepath.Join(t.TempDir(), "config.json")
+	err = os.WriteFile(path, []byte(`{
+		"defaults": {"ch": 9, "thres": 30},
+		"mappings": [
+			{"action": "VAR", "name": "SLOT", "min": 1, "max": 2},
+			{"ev": "0x28", "action": "VAR-SET", "name": "SLOT", "value": 2},
+			{"ev": "0x29", "action": "VAR-INC", "name": "SLOT", "wrap": true},
+			{"ev": "0x2a", "action": "VAR-KEY", "release_ms": 20, "name": "SLOT", "keys": "A;B"},
+			{"action": "SOCD", "keys": ["LEFT", "RIGHT"], "mode": "NEUTRAL"},
+			{"action": "NEW-LAYER", "name": "LAYER", "mode": "OPAQUE"}
+		]
+	}`), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+
+	err = ke.ReadConfig(path)
+	assert(t, err == nil, "Failed to read the config: %+v", err)
+
+	sendMidiEvent(evType, channel, 0x2a, 100, conn)
+	assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+	sendMidiEvent(evType, channel, 0x28, 100, conn)
+	sendMidiEvent(evType, channel, 0x2a, 100, conn)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+	sendMidiEvent(evType, channel, 0x29, 100, conn)
+	sendMidiEvent(evType, channel, 0x2a, 100, conn)
+	assertKeyStates(t, kc[keyA], 40*time.Millisecond, true, false)
+}
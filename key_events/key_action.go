@@ -1,7 +1,8 @@
 package key_events
 
 import (
-	"sync"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/SirGFM/midi-go-key/event_logger"
@@ -11,18 +12,18 @@ import (
 type keyAction struct {
 	// The keys to be pressed/released.
 	keyCodes []int
-	// The internal key controller.
-	kc KeyController
+	// Tracks the keys pressed by every action.
+	keys *keyState
 	// The timer used to release the generated key press.
-	timer *time.Ticker
-	// Synchronizes access to timer.
-	mutex sync.Mutex
+	timer *actionTimer
 	// The action taken when the timer expires, if any.
 	onTimeout timerAction
-	// Queue release actions on the main thread,
-	releaseChannel chan timerAction
-	// Channel used to signal that the action's timer should be stopped forever.
-	stop chan struct{}
+	// For how long the keys may stay pressed before being forcefully released.
+	// Zero if the keys may be held indefinitely.
+	maxHold time.Duration
+	// The timer used to forcefully release keys held for longer than maxHold.
+	// nil if maxHold is zero.
+	watchdog *actionTimer
 	// The key's current state.
 	isPressed bool
 	// The event logger.
@@ -32,18 +33,21 @@ type keyAction struct {
 // newKeyAction creates a new keyAction, with its timer already configured (but stopped).
 // When the timer expires, the release action is sent on releaseChannel.
 // onTimeout may be nil if no custom action is required after releasing the key.
+// If maxHold isn't zero, the key gets released if held for longer than that.
 func newKeyAction(
 	keyCode int,
-	kc KeyController,
+	keys *keyState,
 	releaseChannel chan timerAction,
 	onTimeout timerAction,
+	maxHold time.Duration,
 	el event_logger.EventLogger,
 ) *keyAction {
 	return newKeyActionMulti(
 		[]int{keyCode},
-		kc,
+		keys,
 		releaseChannel,
 		onTimeout,
+		maxHold,
 		el,
 	)
 }
@@ -52,24 +56,26 @@ func newKeyAction(
 // with its timer already configured (but stopped).
 // When the timer expires, the release action is sent on releaseChannel.
 // onTimeout may be nil if no custom action is required after releasing the keys.
+// If maxHold isn't zero, the keys get released if held for longer than that.
 func newKeyActionMulti(
 	keyCodes []int,
-	kc KeyController,
+	keys *keyState,
 	releaseChannel chan timerAction,
 	onTimeout timerAction,
+	maxHold time.Duration,
 	el event_logger.EventLogger,
 ) *keyAction {
 	action := &keyAction{
-		keyCodes:       keyCodes,
-		kc:             kc,
-		timer:          time.NewTicker(time.Second),
-		onTimeout:      onTimeout,
-		releaseChannel: releaseChannel,
-		stop:           make(chan struct{}),
-		el:             el,
+		keyCodes:  keyCodes,
+		keys:      keys,
+		onTimeout: onTimeout,
+		maxHold:   maxHold,
+		el:        el,
+	}
+	action.timer = newActionTimer(releaseChannel, action.release)
+	if maxHold > 0 {
+		action.watchdog = newActionTimer(releaseChannel, action.forceRelease)
 	}
-	action.timer.Stop()
-	go action.waitForTimedAction()
 
 	return action
 }
@@ -79,8 +85,8 @@ func (key *keyAction) IsPressed() bool {
 	return key.isPressed
 }
 
-// log logs the keyAction's state to the remote logger.
-func (key *keyAction) log(state bool) {
+// names lists the name of every key pressed by the keyAction.
+func (key *keyAction) names() []string {
 	var keys []string
 	for _, kc := range key.keyCodes {
 		if kc == -1 {
@@ -95,89 +101,77 @@ func (key *keyAction) log(state bool) {
 		keys = append(keys, name)
 	}
 
-	key.el.SendKeyboardEvent(keys, state)
+	return keys
+}
+
+// log logs the keyAction's state to the remote logger.
+func (key *keyAction) log(state bool) {
+	key.el.SendKeyboardEvent(key.names(), state)
 }
 
 // Press presses the keyCode.
+// If the keyAction has a maximum hold duration,
+// the keys get released once they have been held for that long since the last press.
 func (key *keyAction) Press() {
 	key.isPressed = true
-	key.kc.PressKeys(key.keyCodes...)
+	key.keys.PressKeys(key, key.keyCodes...)
 	key.log(true)
+
+	if key.watchdog != nil {
+		key.watchdog.Reset(key.maxHold)
+	}
 }
 
 // Release the key and pauses its timer.
 func (key *keyAction) Release() {
-	key.stopTimer()
+	key.timer.Stop()
 	key.release()
 }
 
 // release gets called automatically when key.timer expires.
 func (key *keyAction) release() {
+	if key.watchdog != nil {
+		key.watchdog.Stop()
+	}
+
 	key.isPressed = false
-	key.kc.ReleaseKeys(key.keyCodes...)
+	key.keys.ReleaseKeys(key, key.keyCodes...)
 	key.log(false)
 	if key.onTimeout != nil {
 		key.onTimeout()
 	}
 }
 
-// stopTimer releases the timeout from an action.
-// This function is thread safe!
-func (key *keyAction) stopTimer() {
-	key.mutex.Lock()
-	key.timer.Stop()
-	key.mutex.Unlock()
+// forceRelease gets called automatically when key.watchdog expires,
+// releasing keys that have been held for too long (e.g., a forgotten toggle).
+func (key *keyAction) forceRelease() {
+	if !key.isPressed {
+		return
+	}
+
+	names := key.names()
+	log.Printf("key_events: releasing '%s', held for longer than %s", strings.Join(names, ","), key.maxHold)
+	key.el.SendForcedReleaseEvent(names)
+
+	key.Release()
 }
 
 // QueueTimedAction queues an actions to be taken after timeout.
 func (key *keyAction) QueueTimedAction(timeout time.Duration) {
-	key.mutex.Lock()
 	key.timer.Reset(timeout)
-	key.mutex.Unlock()
-}
-
-// waitForTimedAction blocks until a timer event is generated,
-// when it calls its onRelease action.
-// After the actions is called, it stops it's timer.
-func (key *keyAction) waitForTimedAction() {
-	for {
-		select {
-		case <-key.stop:
-			return
-		case <-key.timer.C:
-			// Do nothing and just exits the select.
-		}
-		key.releaseChannel <- key.release
-
-		key.stopTimer()
-	}
 }
 
 // Close releases any resources associated with the MIDI action,
-// and calls release.
+// and releases its keys if they are still pressed.
 func (key *keyAction) Close() error {
-	if key.timer != nil {
-		return nil
-	}
-
-	select {
-	// If the ticker was already stopped, simply exit.
-	case <-key.stop:
-		return nil
-	default:
+	key.timer.Close()
+	if key.watchdog != nil {
+		key.watchdog.Close()
 	}
 
-	// Stop and close the ticker, so it won't be triggered and
-	// so the timer goroutine may exit.
-	key.stopTimer()
-	close(key.stop)
-
-	// Make sure that the ticker is empty.
-	for _ = range key.timer.C {
+	if key.isPressed {
+		key.release()
 	}
 
-	// Call the timeout action, just to be sure that the key is released.
-	key.release()
-
 	return nil
 }
@@ -3,10 +3,12 @@ package key_events
 import (
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/SirGFM/midi-go-key/event_logger"
 	"github.com/SirGFM/midi-go-key/midi"
+	"github.com/SirGFM/midi-go-key/script"
 )
 
 // The action taken (e.g., generate a key press) in response to a MIDI event.
@@ -20,6 +22,9 @@ type namedMidiAction struct {
 	Action midiAction
 	// The function used to register this MIDI action in the event logger.
 	Register midiRegister
+	// Stops anything left running by the action (e.g., a repeating key)
+	// when its named set is deactivated. May be nil.
+	Stop timerAction
 }
 
 // How many timed actions may be queued at once.
@@ -41,7 +46,8 @@ type KeyController interface {
 }
 
 type KeyEvents interface {
-	// Releases every resource associated with the key events generator
+	// Releases every resource associated with the key events generator,
+	// releasing every key that is still pressed.
 	Close() error
 
 	// RegisterBasicPressAction registers the most basic action of pressing and
@@ -129,6 +135,27 @@ type KeyEvents interface {
 		resetKeyCode uint8,
 	)
 
+	// RegisterDiagonalAction registers an action that combines two pads,
+	// key and otherKey, pressing every key in keyCodes (e.g., UP and RIGHT)
+	// whenever both pads are hit within windowMs of each other.
+	// The keys are then held exactly like RegisterHoldAction,
+	// as long as both pads keep being repeated within maxRepeatDelayMs.
+	// Every other event is sent to the actions previously registered to each pad,
+	// so this must be called after registering those.
+	// The first of a series of inputs
+	// is ignored if it's less than or equal to the threshold.
+	RegisterDiagonalAction(
+		evType midi.MidiEventType,
+		channel,
+		key,
+		otherKey uint8,
+		keyCodes []int,
+		threshold uint8,
+		windowMs,
+		maxRepeatDelayMs int32,
+		shortRelease time.Duration,
+	)
+
 	// RegisterMapSwap registers an action that swaps the currently active named set.
 	// This expects the first set to be already active when this function is called,
 	// and thus it initially swaps to the second set.
@@ -140,14 +167,279 @@ type KeyEvents interface {
 		namedSets []string,
 	)
 
+	// RegisterMapSwapBack registers an action that swaps the currently active named set,
+	// exactly like RegisterMapSwap, but moving backward through namedSets.
+	RegisterMapSwapBack(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		namedSets []string,
+	)
+
+	// RegisterMapSelect registers an action that activates the named set namedSet.
+	RegisterMapSelect(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		namedSet string,
+	)
+
+	// RegisterMapReturn registers an action that activates the last used named set
+	// (i.e., the one that was active before the current one).
+	RegisterMapReturn(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+	)
+
+	// RegisterMomentaryMapping registers an action that activates a named set
+	// on top of the active sets only while the MIDI event is held,
+	// deactivating it once it's released.
+	// For Note On events, the set is activated by a Note On
+	// and deactivated by the Note Off (or by a Note On without velocity).
+	// For Control Change events (e.g., a pedal), the set is active
+	// while the controller's value is greater than the threshold.
+	// Otherwise, the input is ignored if it's less than or equal to the threshold.
+	RegisterMomentaryMapping(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		namedSet string,
+	)
+
+	// RegisterPanicAction registers an action that releases every key,
+	// stops every repeating key and resets every sequence back to its start.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterPanicAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+	)
+
+	// RegisterExecAction registers an action that runs command,
+	// passing the MIDI event's channel, key and velocity as the environment variables
+	// MIDI_CHANNEL, MIDI_KEY and MIDI_VELOCITY.
+	// The command is run directly, unless useShell is set,
+	// in which case it's run by the system's shell.
+	// At most maxRunning instances of the command may run at once,
+	// and each of them is killed if it doesn't finish within timeout,
+	// or once the mappings are replaced (e.g., by ReloadConfig) or closed.
+	// If command is empty, or if either timeout or maxRunning isn't positive,
+	// the action isn't registered and ErrConfigActionArgumentInvalid is returned.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterExecAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		timeout time.Duration,
+		maxRunning int,
+		useShell bool,
+		command []string,
+	) error
+
+	// RegisterTurboAction registers an action that starts repeatedly
+	// pressing a key, and that stops it on the following MIDI event.
+	// The key is pressed every period, for half of that period,
+	// where the period is picked between maxPeriod and minPeriod
+	// based on the velocity of the MIDI event.
+	// The greater the velocity, the closer to minPeriod the period is.
+	// The key is also released if the action's named set gets deactivated.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterTurboAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		keyCode int,
+		threshold uint8,
+		minPeriod,
+		maxPeriod time.Duration,
+	)
+
+	// RegisterWebhookAction registers an action that sends an HTTP request.
+	// Both url and body are text/template templates,
+	// which may access the MIDI event's {{.Channel}}, {{.Key}},
+	// {{.Velocity}} and {{.Timestamp}}.
+	// If either isn't a valid template, the action isn't registered and the error is returned.
+	// Requests are sent in the background, so they never delay other events,
+	// and are given up on if they don't finish within timeout.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterWebhookAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		timeout time.Duration,
+		method,
+		url,
+		body string,
+	) error
+
 	// ReadConfig reads the configuration file in path and registers the listed actions.
 	ReadConfig(path string) error
 
+	// SetKitProfile configures a config file that is read before every configuration file,
+	// whose constants (e.g., "define KICK=0x24") name the notes of the drum kit's pads,
+	// so configuration files using those names work with any kit.
+	SetKitProfile(path string)
+
+	// ReloadConfig reads the configuration file in path into a fresh set of mappings,
+	// replacing every registered action once the whole file is read.
+	// Every held key is released before the mappings are replaced,
+	// and the current mappings are kept if the file has any problem.
+	// This function is thread safe, but it blocks until the key events generator handles it,
+	// failing with ErrKeyEventsClosed if the generator already stopped.
+	ReloadConfig(path string) error
+
 	// SetNamedSet configures the active named set.
 	SetNamedSet(name string)
 
 	// RegisterNamedSet creates a new named set and activates it.
+	// Actions in the default, unnamed set take precedence over this set's actions.
 	RegisterNamedSet(name string)
+
+	// RegisterNamedLayer creates a new named set and activates it.
+	// Unlike RegisterNamedSet, this set's actions take precedence
+	// over the default set's actions.
+	// If the layer is opaque, events that it doesn't map are ignored,
+	// instead of being handled by the sets bellow it.
+	RegisterNamedLayer(name string, opaque bool)
+
+	// RegisterSetEnterAction registers an action, in the most recently created named set,
+	// that presses a key and releases it after releaseTime
+	// whenever that set gets activated.
+	RegisterSetEnterAction(keyCode int, releaseTime time.Duration)
+
+	// RegisterSetExitAction registers an action, in the most recently created named set,
+	// that presses a key and releases it after releaseTime
+	// whenever that set gets deactivated.
+	// Any key still pressed by the set's actions is released before this action.
+	RegisterSetExitAction(keyCode int, releaseTime time.Duration)
+
+	// SetMaxHold configures for how long keys pressed by the actions registered
+	// from now on may be held, after which they get automatically released
+	// (e.g., to recover from a toggle that was left pressed).
+	// A maxHold of zero lets keys be held indefinitely, which is the default.
+	SetMaxHold(maxHold time.Duration)
+
+	// RegisterSOCDGroup groups opposing keys (e.g., LEFT and RIGHT),
+	// so at most one of them is actually pressed at a time, regardless of the actions
+	// pressing them, with mode deciding which key that is.
+	// Groups apply to every named set.
+	RegisterSOCDGroup(mode SOCDMode, keyCodes ...int)
+
+	// SetAppendActions configures whether actions registered from now on
+	// are executed alongside the actions already registered to the same MIDI event
+	// (in the order that they were registered), instead of replacing them.
+	// Replacing an action logs a warning, since it's usually a mistake.
+	SetAppendActions(appendActions bool)
+
+	// SetCondition configures a condition that guards the actions registered from now on,
+	// which are only executed if the condition holds when their MIDI event is received.
+	// If an action was already registered to the same MIDI event,
+	// it's executed whenever the condition doesn't hold, instead of being replaced
+	// (unless actions are being appended, in which case it's always executed).
+	// A nil condition registers actions unconditionally, which is the default.
+	SetCondition(cond Condition)
+
+	// IsKeyHeld checks whether any action is currently holding the key, by its keycode.
+	// The key may still not be actually pressed (e.g., if it's suppressed by its SOCD group).
+	IsKeyHeld(keyCode int) bool
+
+	// IsSetActive checks whether the named set is currently active,
+	// either as the selected set or as a layer on top of it.
+	// This must only be called while handling MIDI events (e.g., from a Condition).
+	IsSetActive(name string) bool
+
+	// HitWithin checks whether the MIDI Note On event (channel,key) was hit
+	// within windowMs of the MIDI event ev.
+	// This must only be called while handling MIDI events (e.g., from a Condition).
+	HitWithin(channel, key uint8, windowMs int32, ev midi.MidiEvent) bool
+
+	// RegisterVariable creates (or redefines) a named integer variable,
+	// bounded to [min, max], and sets it to min.
+	// Variables used by actions without being registered are bounded to [0, math.MaxInt32].
+	RegisterVariable(name string, min, max int)
+
+	// Variable returns the current value of the named variable,
+	// and whether the variable exists.
+	// This must only be called while handling MIDI events (e.g., from a Condition).
+	Variable(name string) (int, bool)
+
+	// RegisterVariableAction registers an action that changes the named variable,
+	// either setting it to value, or incrementing/decrementing it by value.
+	// Values outside of the variable's bounds are clamped,
+	// unless wrap is set, in which case incrementing/decrementing wraps around.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterVariableAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		name string,
+		op VariableOp,
+		value int,
+		wrap bool,
+	)
+
+	// RegisterVariableKeyAction registers an action that presses the keys selected by
+	// the named variable, releasing them after releaseTime.
+	// The variable's lowest value presses keyCodes[0], the next one keyCodes[1], and so on.
+	// Values without an associated key are ignored.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterVariableKeyAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		name string,
+		keyCodes [][]int,
+		threshold uint8,
+		releaseTime time.Duration,
+	)
+
+	// RegisterScriptAction registers an action that calls the script's function,
+	// passing it the MIDI event.
+	// The function may press/release keys, queue other functions and switch named sets.
+	// Anything left running by the script (i.e., keys and queued functions)
+	// is stopped if the action's named set gets deactivated.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterScriptAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		program *script.Program,
+		function string,
+	)
+
+	// RegisterPlugin starts an external process, the plugin, which receives MIDI events
+	// on its stdin and replies with commands on its stdout, as one JSON object per line.
+	// Events are sent as {"type":"note-on","channel":9,"key":36,"velocity":100,"timestamp":1234},
+	// and the plugin may reply with the commands:
+	//   - {"cmd":"press","keys":["A","B"]}: presses the keys;
+	//   - {"cmd":"release","keys":["A"]}: releases the keys;
+	//   - {"cmd":"tap","keys":["A"],"ms":50}: presses the keys, releasing them after ms;
+	//   - {"cmd":"use","set":"SET_B"}: activates the named set.
+	// The plugin is restarted whenever it exits, and it's killed once the key events generator is closed.
+	// A plugin registered with the same name as an earlier plugin replaces it.
+	RegisterPlugin(name string, command []string)
+
+	// RegisterPluginAction registers an action that sends the MIDI event to the named plugin.
+	// Events are dropped if the plugin isn't keeping up with them,
+	// so a slow plugin never delays other events.
+	// The input is ignored if it's less than or equal to the threshold.
+	RegisterPluginAction(
+		evType midi.MidiEventType,
+		channel,
+		key uint8,
+		threshold uint8,
+		name string,
+	)
 }
 
 // A MIDI event generated for a given note,
@@ -157,29 +449,126 @@ type noteEvent [2]byte
 // An timerAction generated by a timer.
 type timerAction func()
 
-type actionSet map[noteEvent]midiAction
+// Identifies a keyAction by the keys that it presses, by how long they may be held
+// and by the named set using it.
+type keyActionID struct {
+	// The keys pressed by the keyAction.
+	keyCodes uint64
+	// For how long the keys may be held.
+	maxHold time.Duration
+	// The named set whose actions use the keyAction, or an empty string for the default set.
+	// Each set presses keys through its own keyAction, so a key pressed by different sets
+	// is only released once every one of them releases it.
+	set string
+}
 
 type namedActionSet map[noteEvent]namedMidiAction
 
 type keyEvents struct {
+	// The mappings read from the config file, swapped as a whole whenever the config is reloaded.
+	*mappingTable
 	// The internal key controller.
 	kc KeyController
 	// The channel used to receive MIDI events.
 	conn <-chan midi.MidiEvent
-	// List actions taken in response to the registered actions.
-	actions actionSet
-	// List of named action sets taken in response to the registered actions.
-	namedSets map[string]namedActionSet
-	// The currently active named action set.
-	curSet string
-	// List actions responsible for pressing/releasing keys.
-	keyActions map[uint64]*keyAction
+	// For how long keys pressed by new actions may be held.
+	maxHold time.Duration
+	// Whether new actions are added to the actions already registered to their events.
+	appendActions bool
+	// The condition that guards new actions, if any.
+	condition Condition
 	// Receive actions that should be generated based on a timer.
 	timedAction chan timerAction
+	// Receive requests to reload the config file.
+	reloads chan configReload
+	// Closed to request the main thread to stop.
+	stop chan struct{}
+	// Ensures that stop is only closed once.
+	stopOnce sync.Once
+	// Closed once the main thread stops, after releasing every key.
+	done chan struct{}
+	// The error returned by closing the key controller, set before done is closed.
+	closeErr error
+	// The config file read before every config file, usually defining the pads of the drum kit.
+	kitProfile string
 	// Whether unhandled events should be logged.
 	logUnhandled bool
 	// The event logger.
 	el event_logger.EventLogger
+	// Whether the config is only being checked (see CheckConfig),
+	// so plugins aren't started and overridden actions aren't logged.
+	dryRun bool
+}
+
+// Every action registered to the key events generator,
+// and the state of those actions.
+type mappingTable struct {
+	// Tracks every key pressed through the internal key controller.
+	keys *keyState
+	// List actions taken in response to the registered actions.
+	actions namedActionSet
+	// List of named action sets taken in response to the registered actions.
+	namedSets map[string]namedActionSet
+	// How each named set is layered in relation to the default set.
+	setModes map[string]layerMode
+	// The currently active named action set.
+	// While registering actions, this is instead the set receiving the actions.
+	curSet string
+	// Whether curSet was activated by SetNamedSet,
+	// instead of simply being the set receiving new actions.
+	isCurSetActive bool
+	// Named sets temporarily activated on top of the current one,
+	// from the bottom of the stack to its top.
+	layers []string
+	// Events that must be sent to a given action, regardless of the active sets.
+	captured map[noteEvent]midiAction
+	// The named action set that was active before the current one.
+	lastSet string
+	// List actions responsible for pressing/releasing keys.
+	keyActions map[keyActionID]*keyAction
+	// When each MIDI Note On event was last hit, by its timestamp.
+	lastHits map[noteEvent]int32
+	// The named variables, which actions may change or read.
+	variables map[string]*variable
+	// The scripts used by actions, by their paths.
+	scripts map[string]*script.Program
+	// The plugins used by actions, by their names.
+	plugins map[string]*plugin
+	// The handles used by custom actions to press keys.
+	handles []*actionHandle
+	// Where the actions being registered were defined (e.g., a line in the config file),
+	// used to give context to warnings.
+	location string
+	// List the actions responsible for pressing/releasing keys used by each named set.
+	setKeyActions map[string][]*keyAction
+	// Actions executed whenever each named set gets activated.
+	enterActions map[string][]timerAction
+	// Actions executed whenever each named set gets deactivated.
+	exitActions map[string][]timerAction
+	// Actions that reset the state of other actions (e.g., a sequence's current key).
+	resetActions []timerAction
+	// Actions that release the resources used by other actions (e.g., a webhook's goroutine)
+	// once the mappings are replaced or closed.
+	closeActions []timerAction
+}
+
+// newMappingTable creates an empty mapping table, pressing keys through kc.
+func newMappingTable(kc KeyController) *mappingTable {
+	return &mappingTable{
+		keys:          newKeyState(kc),
+		actions:       make(namedActionSet),
+		namedSets:     make(map[string]namedActionSet),
+		setModes:      make(map[string]layerMode),
+		captured:      make(map[noteEvent]midiAction),
+		lastHits:      make(map[noteEvent]int32),
+		variables:     make(map[string]*variable),
+		scripts:       make(map[string]*script.Program),
+		plugins:       make(map[string]*plugin),
+		keyActions:    make(map[keyActionID]*keyAction),
+		setKeyActions: make(map[string][]*keyAction),
+		enterActions:  make(map[string][]timerAction),
+		exitActions:   make(map[string][]timerAction),
+	}
 }
 
 // NewKeyEvents creates and starts a new event generator.
@@ -190,41 +579,105 @@ func NewKeyEvents(
 	logUnhandled bool,
 	el event_logger.EventLogger,
 ) (KeyEvents, error) {
-	kbEv := &keyEvents{
+	kbEv := newKeyEvents(kc, conn, logUnhandled, el)
+	go kbEv.run()
+
+	return kbEv, nil
+}
+
+// newKeyEvents creates the key events generator, without listening for MIDI events.
+func newKeyEvents(
+	kc KeyController,
+	conn <-chan midi.MidiEvent,
+	logUnhandled bool,
+	el event_logger.EventLogger,
+) *keyEvents {
+	return &keyEvents{
+		mappingTable: newMappingTable(kc),
 		kc:           kc,
 		conn:         conn,
-		actions:      make(map[noteEvent]midiAction),
-		namedSets:    make(map[string]namedActionSet),
-		keyActions:   make(map[uint64]*keyAction),
 		timedAction:  make(chan timerAction, timedActionQueueSize),
+		reloads:      make(chan configReload),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
 		logUnhandled: logUnhandled,
 		el:           el,
 	}
-	go kbEv.run()
-
-	return kbEv, nil
 }
 
 func (kbEv *keyEvents) SetNamedSet(name string) {
+	prevSet := kbEv.curSet
+	wasActive := kbEv.isCurSetActive
+
+	if wasActive && name == prevSet {
+		kbEv.registerActiveSets()
+		return
+	}
+
 	kbEv.curSet = name
-	for _, action := range kbEv.namedSets[name] {
-		action.Register()
+	kbEv.isCurSetActive = true
+
+	// Only deactivate the previous set if it was actually in use,
+	// instead of simply receiving new actions.
+	if wasActive {
+		kbEv.lastSet = prevSet
+		kbEv.deactivateSet(prevSet)
 	}
+	kbEv.activateSet(name)
+
+	kbEv.registerActiveSets()
 }
 
 func (kbEv *keyEvents) RegisterNamedSet(name string) {
 	kbEv.namedSets[name] = make(namedActionSet)
+	kbEv.setModes[name] = layerUnder
 	kbEv.curSet = name
+	kbEv.isCurSetActive = false
+}
+
+func (kbEv *keyEvents) SetKitProfile(path string) {
+	kbEv.kitProfile = path
+}
+
+func (kbEv *keyEvents) SetMaxHold(maxHold time.Duration) {
+	kbEv.maxHold = maxHold
 }
 
 func (kbEv *keyEvents) Close() error {
-	return kbEv.kc.Close()
+	kbEv.stopOnce.Do(func() { close(kbEv.stop) })
+	<-kbEv.done
+
+	return kbEv.closeErr
 }
 
-// run listens for MIDI events and generates key events.
+// closeMappings stops every registered action and releases every key pressed by them,
+// closing the resources used by the actions (e.g., their timers and plugins).
+func (kbEv *keyEvents) closeMappings() {
+	kbEv.stopAll()
+	for _, plugin := range kbEv.plugins {
+		plugin.Close()
+	}
+	for _, keyAction := range kbEv.keyActions {
+		keyAction.Close()
+	}
+	for _, handle := range kbEv.handles {
+		handle.Close()
+	}
+	for _, closeAction := range kbEv.closeActions {
+		closeAction()
+	}
+	kbEv.keys.ReleaseAll()
+}
+
+// run listens for MIDI events and generates key events,
+// until either conn gets closed or the key events generator gets closed.
 func (kbEv *keyEvents) run() {
+	defer kbEv.shutdown()
+
 	for {
 		select {
+		case <-kbEv.stop:
+			return
 		case midiEv, hasMore := <-kbEv.conn:
 			if !hasMore {
 				return
@@ -234,10 +687,22 @@ func (kbEv *keyEvents) run() {
 			// timedAction are queued as a response to MIDI events,
 			// so just execute them as they are received.
 			action()
+		case reload := <-kbEv.reloads:
+			reload.done <- kbEv.reloadConfig(reload.path)
 		}
 	}
 }
 
+// shutdown releases every key and closes the key controller, signaling that the main thread stopped.
+// Any action still queued on timedAction is simply dropped.
+//
+// Must be called from the main thread, so no action runs while the keys are released.
+func (kbEv *keyEvents) shutdown() {
+	kbEv.closeMappings()
+	kbEv.closeErr = kbEv.keys.Close()
+	close(kbEv.done)
+}
+
 // handleMidiEvent handles a given MIDI event,
 // executing its registered action.
 func (kbEv *keyEvents) handleMidiEvent(midiEv midi.MidiEvent) {
@@ -249,16 +714,9 @@ func (kbEv *keyEvents) handleMidiEvent(midiEv midi.MidiEvent) {
 	}
 	copy(event[:], midiEv.Source)
 
-	action, ok := kbEv.actions[event]
+	action, ok := kbEv.captured[event]
 	if !ok {
-		// If the action isn't on the default set,
-		// check if it's in the currently active named set.
-		if set, found := kbEv.namedSets[kbEv.curSet]; found {
-			if namedAction, found := set[event]; found {
-				action = namedAction.Action
-				ok = true
-			}
-		}
+		action, ok = kbEv.lookupAction(event)
 	}
 
 	if ok {
@@ -266,6 +724,8 @@ func (kbEv *keyEvents) handleMidiEvent(midiEv midi.MidiEvent) {
 	} else if kbEv.logUnhandled {
 		log.Printf("unhandled: %s\n", midiEv)
 	}
+
+	kbEv.recordHit(event, midiEv)
 }
 
 // generateNoteEvent generates noteEvent from the desired parameters.
@@ -282,19 +742,56 @@ func generateNoteEvent(evType midi.MidiEventType, channel, key uint8) noteEvent
 // The action is removed from the currently active named set,
 // or from the default, unnamed set if no named set has been activated yet.
 func (kbEv *keyEvents) removeAction(event noteEvent) {
+	// Conditional actions fall back to the previous action, instead of replacing it.
+	if kbEv.appendActions || kbEv.condition != nil {
+		return
+	}
+
+	set := kbEv.actions
 	if kbEv.curSet != "" {
-		set, ok := kbEv.namedSets[kbEv.curSet]
+		var ok bool
+		set, ok = kbEv.namedSets[kbEv.curSet]
 		if !ok {
 			return
 		}
+	}
+
+	if _, ok := set[event]; ok {
+		kbEv.warnOverride(event)
 		delete(set, event)
-	} else {
-		if _, ok := kbEv.actions[event]; ok {
-			delete(kbEv.actions, event)
-		}
 	}
 }
 
+// warnOverride logs that the action registered to event is being replaced.
+func (kbEv *keyEvents) warnOverride(event noteEvent) {
+	if kbEv.dryRun {
+		// Overridden actions are reported by CheckConfig itself.
+		return
+	}
+
+	where := "key_events"
+	if kbEv.location != "" {
+		where = kbEv.location
+	}
+
+	set := "the default set"
+	if kbEv.curSet != "" {
+		set = "set '" + kbEv.curSet + "'"
+	}
+
+	log.Printf(
+		"%s: warning: overriding the action of ch=%d ev=%#x in %s (prefix the line with '+' to keep both)",
+		where,
+		event[0]&0xf,
+		event[1],
+		set,
+	)
+}
+
+func (kbEv *keyEvents) SetAppendActions(appendActions bool) {
+	kbEv.appendActions = appendActions
+}
+
 // registerAction registers an action to the given event.
 // The action is registered to the currently active named set,
 // or to the default, unnamed set if no named set has been activated yet.
@@ -306,39 +803,95 @@ func (kbEv *keyEvents) registerAction(
 	action midiAction,
 	register midiRegister,
 ) {
+	kbEv.registerStoppableAction(event, action, register, nil)
+}
+
+// registerStoppableAction registers an action to the given event,
+// exactly like registerAction.
+// However, if the action is registered to a named set,
+// stop is called whenever that set gets deactivated.
+func (kbEv *keyEvents) registerStoppableAction(
+	event noteEvent,
+	action midiAction,
+	register midiRegister,
+	stop timerAction,
+) {
+	newAction := namedMidiAction{
+		Action:   action,
+		Register: register,
+		Stop:     stop,
+	}
+
+	set := kbEv.actions
 	if kbEv.curSet != "" {
-		set, ok := kbEv.namedSets[kbEv.curSet]
+		var ok bool
+		set, ok = kbEv.namedSets[kbEv.curSet]
 		if !ok {
 			return
 		}
-		set[event] = namedMidiAction{
-			Action:   action,
-			Register: register,
+	}
+
+	prev, hasPrev := set[event]
+	if kbEv.condition != nil {
+		var fallback *namedMidiAction
+		if hasPrev && !kbEv.appendActions {
+			fallback = &prev
 		}
-	} else {
-		kbEv.actions[event] = action
+		newAction = guardAction(kbEv.condition, newAction, fallback)
+	}
+	if hasPrev && kbEv.appendActions {
+		newAction = mergeActions(prev, newAction)
+	}
+	set[event] = newAction
+
+	if kbEv.curSet == "" {
 		register()
 	}
 }
 
+// mergeActions combines two actions registered to the same event into a single one,
+// which executes first and then second.
+func mergeActions(first, second namedMidiAction) namedMidiAction {
+	return namedMidiAction{
+		Action: func(ev midi.MidiEvent) {
+			first.Action(ev)
+			second.Action(ev)
+		},
+		Register: func() {
+			first.Register()
+			second.Register()
+		},
+		Stop: func() {
+			if first.Stop != nil {
+				first.Stop()
+			}
+			if second.Stop != nil {
+				second.Stop()
+			}
+		},
+	}
+}
+
 // newKeyAction creates a new keyAction, with its timer already configured (but stopped).
-// If an action has already been registered for that keyCode,
-// then that first action will be returned instead.
+// If an action has already been registered for that keyCode (and maximum hold duration)
+// in the set receiving new actions, then that first action will be returned instead.
 //
 // This function isn't thread safe and should be called before any event is received.
 func (kbEv *keyEvents) newKeyAction(keyCode int, onTimeout timerAction) *keyAction {
-	if action, ok := kbEv.keyActions[uint64(keyCode)]; ok {
+	id := keyActionID{uint64(keyCode), kbEv.maxHold, kbEv.curSet}
+	if action, ok := kbEv.keyActions[id]; ok {
 		return action
 	}
 
-	action := newKeyAction(keyCode, kbEv.kc, kbEv.timedAction, onTimeout, kbEv.el)
-	kbEv.keyActions[uint64(keyCode)] = action
+	action := newKeyAction(keyCode, kbEv.keys, kbEv.timedAction, onTimeout, kbEv.maxHold, kbEv.el)
+	kbEv.keyActions[id] = action
+	kbEv.ownKeyAction(action)
 	return action
 }
 
 // newKeyActionMulti creates a new keyAction for multiple keys, with its timer already configured (but stopped).
-// If an action has already been registered for that keyCode,
-// then that first action will be returned instead.
+// If an action has already been registered for that keyCode (and maximum hold duration)
+// in the set receiving new actions, then that first action will be returned instead.
 //
 // This function isn't thread safe and should be called before any event is received.
 // Also, keyCodes must have at most 4 keys.
@@ -355,15 +908,28 @@ func (kbEv *keyEvents) newKeyActionMulti(keyCodes []int, onTimeout timerAction)
 		code |= uint64(key << (i * 16))
 	}
 
-	if action, ok := kbEv.keyActions[code]; ok {
+	id := keyActionID{code, kbEv.maxHold, kbEv.curSet}
+	if action, ok := kbEv.keyActions[id]; ok {
 		return action
 	}
 
-	action := newKeyActionMulti(keyCodes, kbEv.kc, kbEv.timedAction, onTimeout, kbEv.el)
-	kbEv.keyActions[code] = action
+	action := newKeyActionMulti(keyCodes, kbEv.keys, kbEv.timedAction, onTimeout, kbEv.maxHold, kbEv.el)
+	kbEv.keyActions[id] = action
+	kbEv.ownKeyAction(action)
 	return action
 }
 
+// ownKeyAction associates the keyAction with the named set receiving new actions, if any,
+// so its keys get released whenever that set is deactivated.
+// Since keyActions aren't shared between sets, this doesn't affect the keys pressed by other sets.
+func (kbEv *keyEvents) ownKeyAction(action *keyAction) {
+	if kbEv.curSet == "" {
+		return
+	}
+
+	kbEv.setKeyActions[kbEv.curSet] = append(kbEv.setKeyActions[kbEv.curSet], action)
+}
+
 func (kbEv *keyEvents) RegisterBasicPressAction(
 	evType midi.MidiEventType,
 	channel,
@@ -585,20 +1151,20 @@ func (kbEv *keyEvents) RegisterSequenceHoldAction(
 		actions = append(actions, kbEv.newKeyActionMulti(keys, nil))
 	}
 	// Set the first action as the active one.
-	cur := 0
+	cur := newVariable(0, len(actions)-1)
 
 	// Stores the last time the MIDI event was received.
 	var lastTimestamp int32
 
 	// Update the key logged for the currenct action.
 	registerAction := func() {
-		keyboard := keyNames[cur]
+		keyboard := keyNames[cur.Index()]
 		kbEv.el.SendRegisterEvent(channel, key, keyboard)
 	}
 
 	// Register the onPress function for activating the current key.
 	pressAction := func(ev midi.MidiEvent) {
-		keyAction := actions[cur]
+		keyAction := actions[cur.Index()]
 
 		wasPressed := (ev.Timestamp-lastTimestamp > maxRepeatDelayMs)
 
@@ -627,10 +1193,7 @@ func (kbEv *keyEvents) RegisterSequenceHoldAction(
 			return
 		}
 
-		cur--
-		if cur < 0 {
-			cur = len(actions) - 1
-		}
+		cur.Add(-1, true)
 		registerAction()
 		kbEv.el.SendMIDIEvent(channel, prevKeyCode)
 	}
@@ -641,11 +1204,7 @@ func (kbEv *keyEvents) RegisterSequenceHoldAction(
 			return
 		}
 
-		cur++
-		if cur >= len(actions) {
-			cur = 0
-		}
-
+		cur.Add(1, true)
 		registerAction()
 		kbEv.el.SendMIDIEvent(channel, nextKeyCode)
 	}
@@ -656,7 +1215,7 @@ func (kbEv *keyEvents) RegisterSequenceHoldAction(
 			return
 		}
 
-		cur = 0
+		cur.Reset()
 		registerAction()
 		kbEv.el.SendMIDIEvent(channel, resetKeyCode)
 	}
@@ -671,6 +1230,8 @@ func (kbEv *keyEvents) RegisterSequenceHoldAction(
 
 	registerReset := func() { kbEv.el.SendRegisterEvent(channel, resetKeyCode, "RESET-ACTION") }
 	kbEv.registerAction(resetEvent, resetAction, registerReset)
+
+	kbEv.resetActions = append(kbEv.resetActions, cur.Reset)
 }
 
 func (kbEv *keyEvents) RegisterMapSwap(
@@ -679,27 +1240,52 @@ func (kbEv *keyEvents) RegisterMapSwap(
 	key uint8,
 	threshold uint8,
 	namedSets []string,
+) {
+	kbEv.registerMapCycle(evType, channel, key, threshold, namedSets, 1, "CHANGE-MODE")
+}
+
+// registerMapCycle registers an action that moves step sets
+// from the currently active named set in namedSets, wrapping around.
+// If the active set isn't in namedSets, the cycle starts from its beginning.
+func (kbEv *keyEvents) registerMapCycle(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	namedSets []string,
+	step int,
+	name string,
 ) {
 	event := generateNoteEvent(evType, channel, key)
 	kbEv.removeAction(event)
 
-	// The currently active named set.
-	curSet := 0
-
 	// Register the onPress function.
 	action := func(ev midi.MidiEvent) {
 		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
 			return
 		}
 
-		curSet++
-		if curSet >= len(namedSets) {
+		// Look for the currently active named set,
+		// so sets activated by other actions are taken into account.
+		curSet := -1
+		for i, set := range namedSets {
+			if set == kbEv.curSet {
+				curSet = i
+				break
+			}
+		}
+
+		if curSet == -1 && step < 0 {
 			curSet = 0
 		}
+		curSet = (curSet + step) % len(namedSets)
+		if curSet < 0 {
+			curSet += len(namedSets)
+		}
 		kbEv.SetNamedSet(namedSets[curSet])
 		kbEv.el.SendMIDIEvent(channel, key)
 	}
 
-	register := func() { kbEv.el.SendRegisterEvent(channel, key, "CHANGE-MODE") }
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, name) }
 	kbEv.registerAction(event, action, register)
 }
@@ -9,6 +9,10 @@ import (
 	"github.com/SirGFM/midi-go-key/midi"
 )
 
+// How many state changes may be queued on a mocked key code,
+// so the key events generator may still be closed after a test fails without reading them.
+const mockStateQueueSize = 8
+
 // A single mocked key code.
 type mockKeyCode struct {
 	// Signal that the keyCode changed to a new state.
@@ -20,8 +24,8 @@ type mockKeyCode struct {
 // Set switches the key code to the new state, only if not set.
 func (kc *mockKeyCode) Set(state bool) {
 	if kc.state != state {
-		kc.newState <- state
 		kc.state = state
+		kc.newState <- state
 	}
 }
 
@@ -33,7 +37,7 @@ func NewMockKeyController(keyCodes ...int) mockKeyController {
 
 	for _, keyCode := range keyCodes {
 		kc[keyCode] = &mockKeyCode{
-			newState: make(chan bool, 1),
+			newState: make(chan bool, mockStateQueueSize),
 			state:    false,
 		}
 	}
@@ -225,6 +229,47 @@ func TestBasicPress(t *testing.T) {
 	)
 }
 
+func TestAppendActions(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const keyCodeA = 3
+	const keyCodeB = 4
+	const keyCodeC = 5
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCodeA, keyCodeB, keyCodeC)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterBasicPressAction(evType, channel, midiKey, keyCodeA, threshold, releaseTime)
+	ke.SetAppendActions(true)
+	ke.RegisterBasicPressAction(evType, channel, midiKey, keyCodeB, threshold, releaseTime)
+
+	// Test that the event executes every appended action.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyCodeA], 10*time.Millisecond, true)
+	assertKeyStates(t, kc[keyCodeB], 10*time.Millisecond, true)
+	assertKeyStates(t, kc[keyCodeA], releaseTime+10*time.Millisecond, false)
+	assertKeyStates(t, kc[keyCodeB], 10*time.Millisecond, false)
+
+	// Test that actions are replaced once appending is disabled.
+	ke.SetAppendActions(false)
+	ke.RegisterBasicPressAction(evType, channel, midiKey, keyCodeC, threshold, releaseTime)
+
+	assertKeyEvent(t, kc, keyCodeC, evType, channel, midiKey, 100, conn, releaseTime, 10*time.Millisecond)
+	assert(t, !kc[keyCodeA].state && !kc[keyCodeB].state, "replaced actions were executed")
+}
+
 func TestVelocityPress(t *testing.T) {
 	const evType = midi.EventNoteOn
 	const channel = 1
@@ -454,6 +499,57 @@ func TestTogglePress(t *testing.T) {
 	)
 }
 
+func TestTogglePressMaxHold(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const keyCode = 3
+	const shortRelease = 10 * time.Millisecond
+	const maxHold = 40 * time.Millisecond
+	const threshold = 30
+	const toggleThreshold = 80
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.SetMaxHold(maxHold)
+	ke.RegisterToggleAction(
+		evType,
+		channel,
+		midiKey,
+		keyCode,
+		threshold,
+		toggleThreshold,
+		shortRelease,
+	)
+
+	// Test that the toggled keyCode gets released after maxHold,
+	// and that the following MIDI event toggles it again.
+	for i := 0; i < 2; i++ {
+		assertKeyEvent(
+			t,
+			kc,
+			keyCode,
+			evType,
+			channel,
+			midiKey,
+			toggleThreshold+1,
+			conn,
+			maxHold,
+			time.Millisecond*10,
+		)
+	}
+}
+
 func TestHoldMultiKeys(t *testing.T) {
 	const evType = midi.EventNoteOn
 	const channel = 1
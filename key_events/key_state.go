@@ -0,0 +1,213 @@
+package key_events
+
+import (
+	"sync"
+)
+
+// Tracks every key pressed through a KeyController,
+// so they may all be released at once.
+//
+// Each physical key is reference counted by the actions that pressed it,
+// so a key shared by multiple actions (e.g., 'UP' in the steps 'UP' and 'UP,RIGHT'
+// of a sequence) stays pressed until every one of those actions releases it.
+//
+// Keys may also be part of a SOCD group, in which case the group decides
+// which of its held keys actually gets pressed.
+type keyState struct {
+	// The internal key controller.
+	kc KeyController
+	// Synchronizes access to owners, groups and pressed.
+	mutex sync.Mutex
+	// The actions currently holding each key.
+	// Only keys that are currently held are in the map.
+	owners map[int]map[*keyAction]bool
+	// The SOCD group of each key, if any.
+	groups map[int]*socdGroup
+	// The keys actually pressed in the internal key controller.
+	pressed map[int]bool
+}
+
+// newKeyState creates a new keyState that controls the keyboard through kc.
+func newKeyState(kc KeyController) *keyState {
+	return &keyState{
+		kc:      kc,
+		owners:  make(map[int]map[*keyAction]bool),
+		groups:  make(map[int]*socdGroup),
+		pressed: make(map[int]bool),
+	}
+}
+
+// Close releases every pressed key and then closes the internal key controller.
+func (ks *keyState) Close() error {
+	ks.ReleaseAll()
+	return ks.kc.Close()
+}
+
+// AddSOCDGroup groups the keys, so at most one of them is pressed at a time,
+// resolving which one based on mode.
+// Keys already in another group are moved to this new group.
+func (ks *keyState) AddSOCDGroup(mode SOCDMode, keyCodes ...int) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	group := &socdGroup{
+		mode:     mode,
+		keyCodes: append([]int(nil), keyCodes...),
+	}
+
+	var changed []int
+	for _, keyCode := range keyCodes {
+		if prev, ok := ks.groups[keyCode]; ok {
+			prev.remove(keyCode)
+			changed = append(changed, prev.keyCodes...)
+		}
+		ks.groups[keyCode] = group
+
+		if _, ok := ks.owners[keyCode]; ok {
+			group.press(keyCode)
+		}
+	}
+
+	ks.sync(append(changed, keyCodes...))
+}
+
+// PressKeys presses the requested keys, by their keycode, on behalf of owner.
+// Keys that were already pressed by another owner aren't pressed again.
+func (ks *keyState) PressKeys(owner *keyAction, keyCodes ...int) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	for _, keyCode := range keyCodes {
+		owners, ok := ks.owners[keyCode]
+		if !ok {
+			owners = make(map[*keyAction]bool)
+			ks.owners[keyCode] = owners
+
+			if group, ok := ks.groups[keyCode]; ok {
+				group.press(keyCode)
+			}
+		}
+		owners[owner] = true
+	}
+
+	ks.sync(keyCodes)
+}
+
+// ReleaseKeys releases the requested keys, by their keycode, on behalf of owner.
+// Keys are only actually released once every owner that pressed them releases them.
+func (ks *keyState) ReleaseKeys(owner *keyAction, keyCodes ...int) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	for _, keyCode := range keyCodes {
+		owners, ok := ks.owners[keyCode]
+		if !ok || !owners[owner] {
+			continue
+		}
+
+		delete(owners, owner)
+		if len(owners) == 0 {
+			delete(ks.owners, keyCode)
+
+			if group, ok := ks.groups[keyCode]; ok {
+				group.release(keyCode)
+			}
+		}
+	}
+
+	ks.sync(keyCodes)
+}
+
+// IsHeld checks whether any owner is currently holding the key,
+// even if it isn't actually pressed because of its SOCD group.
+func (ks *keyState) IsHeld(keyCode int) bool {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	_, ok := ks.owners[keyCode]
+	return ok
+}
+
+// ReleaseAll releases every pressed key, regardless of their owners.
+func (ks *keyState) ReleaseAll() {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	for _, group := range ks.groups {
+		group.held = nil
+	}
+	ks.owners = make(map[int]map[*keyAction]bool)
+
+	var keyCodes []int
+	for keyCode := range ks.pressed {
+		keyCodes = append(keyCodes, keyCode)
+	}
+	if len(keyCodes) == 0 {
+		return
+	}
+
+	ks.pressed = make(map[int]bool)
+	ks.kc.ReleaseKeys(keyCodes...)
+}
+
+// shouldPress checks whether keyCode should actually be pressed,
+// based on whether it's held and on its SOCD group.
+//
+// Must be called with the mutex locked.
+func (ks *keyState) shouldPress(keyCode int) bool {
+	if _, ok := ks.owners[keyCode]; !ok {
+		return false
+	}
+
+	group, ok := ks.groups[keyCode]
+	if !ok {
+		return true
+	}
+
+	active, ok := group.active()
+	return ok && active == keyCode
+}
+
+// sync presses/releases keyCodes (and every other key in their SOCD groups),
+// so the internal key controller matches their expected state.
+// Keys are released before new keys are pressed,
+// so opposing keys are never pressed at the same time.
+//
+// Must be called with the mutex locked.
+func (ks *keyState) sync(keyCodes []int) {
+	checked := make(map[int]bool)
+	var press, release []int
+
+	check := func(keyCode int) {
+		if checked[keyCode] {
+			return
+		}
+		checked[keyCode] = true
+
+		want := ks.shouldPress(keyCode)
+		if want && !ks.pressed[keyCode] {
+			ks.pressed[keyCode] = true
+			press = append(press, keyCode)
+		} else if !want && ks.pressed[keyCode] {
+			delete(ks.pressed, keyCode)
+			release = append(release, keyCode)
+		}
+	}
+
+	for _, keyCode := range keyCodes {
+		if group, ok := ks.groups[keyCode]; ok {
+			for _, other := range group.keyCodes {
+				check(other)
+			}
+		} else {
+			check(keyCode)
+		}
+	}
+
+	if len(release) > 0 {
+		ks.kc.ReleaseKeys(release...)
+	}
+	if len(press) > 0 {
+		ks.kc.PressKeys(press...)
+	}
+}
@@ -0,0 +1,109 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyStateSharedKeys(t *testing.T) {
+	const keyUp = 1
+	const keyRight = 2
+	const timeout = 10 * time.Millisecond
+
+	kc := NewMockKeyController(keyUp, keyRight)
+	ks := newKeyState(kc)
+	defer ks.Close()
+
+	// Simulate two steps of a sequence, 'UP' and 'UP,RIGHT'.
+	up := &keyAction{keyCodes: []int{keyUp}}
+	upRight := &keyAction{keyCodes: []int{keyUp, keyRight}}
+
+	ks.PressKeys(up, up.keyCodes...)
+	assertKeyStates(t, kc[keyUp], timeout, true)
+	ks.PressKeys(upRight, upRight.keyCodes...)
+	assertKeyStates(t, kc[keyRight], timeout, true)
+
+	// Test that releasing one of the owners keeps the shared key pressed.
+	ks.ReleaseKeys(upRight, upRight.keyCodes...)
+	assertKeyStates(t, kc[keyRight], timeout, false)
+	assert(t, kc[keyUp].state, "shared key was released while still owned")
+
+	// Test that releasing an owner multiple times doesn't release the key for the other owners.
+	ks.PressKeys(upRight, upRight.keyCodes...)
+	assertKeyStates(t, kc[keyRight], timeout, true)
+	ks.ReleaseKeys(up, up.keyCodes...)
+	ks.ReleaseKeys(up, up.keyCodes...)
+	assert(t, kc[keyUp].state, "shared key was released while still owned")
+
+	// Test that the key is released once its last owner releases it.
+	ks.ReleaseKeys(upRight, upRight.keyCodes...)
+	assertKeyStates(t, kc[keyUp], timeout, false)
+	assertKeyStates(t, kc[keyRight], timeout, false)
+}
+
+func TestKeyStateSOCD(t *testing.T) {
+	const keyLeft = 1
+	const keyRight = 2
+	const timeout = 10 * time.Millisecond
+
+	for _, tc := range []struct {
+		name string
+		mode SOCDMode
+	}{
+		{"last", SOCDLastWins},
+		{"first", SOCDFirstWins},
+		{"neutral", SOCDNeutral},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kc := NewMockKeyController(keyLeft, keyRight)
+			ks := newKeyState(kc)
+			defer ks.Close()
+
+			ks.AddSOCDGroup(tc.mode, keyLeft, keyRight)
+
+			left := &keyAction{keyCodes: []int{keyLeft}}
+			right := &keyAction{keyCodes: []int{keyRight}}
+
+			ks.PressKeys(left, keyLeft)
+			assertKeyStates(t, kc[keyLeft], timeout, true)
+
+			// Test that pressing the opposing key resolves the conflict.
+			ks.PressKeys(right, keyRight)
+			switch tc.mode {
+			case SOCDLastWins:
+				assertKeyStates(t, kc[keyLeft], timeout, false)
+				assertKeyStates(t, kc[keyRight], timeout, true)
+			case SOCDFirstWins:
+				assert(t, kc[keyLeft].state && !kc[keyRight].state, "the first key didn't win")
+			case SOCDNeutral:
+				assertKeyStates(t, kc[keyLeft], timeout, false)
+				assert(t, !kc[keyRight].state, "the opposing key was pressed")
+			}
+
+			// Test that the remaining key gets pressed once the conflict is over.
+			ks.ReleaseKeys(left, keyLeft)
+			switch tc.mode {
+			case SOCDLastWins:
+				assert(t, !kc[keyLeft].state && kc[keyRight].state, "the last key didn't stay pressed")
+			case SOCDFirstWins, SOCDNeutral:
+				assertKeyStates(t, kc[keyRight], timeout, true)
+			}
+
+			ks.ReleaseKeys(right, keyRight)
+			assertKeyStates(t, kc[keyRight], timeout, false)
+			assert(t, !kc[keyLeft].state, "key wasn't released")
+
+			// Test that releasing the last key restores the first one (for last-wins).
+			if tc.mode == SOCDLastWins {
+				ks.PressKeys(left, keyLeft)
+				assertKeyStates(t, kc[keyLeft], timeout, true)
+				ks.PressKeys(right, keyRight)
+				assertKeyStates(t, kc[keyLeft], timeout, false)
+				assertKeyStates(t, kc[keyRight], timeout, true)
+				ks.ReleaseKeys(right, keyRight)
+				assertKeyStates(t, kc[keyRight], timeout, false)
+				assertKeyStates(t, kc[keyLeft], timeout, true)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package key_events
+
+import (
+	"time"
+)
+
+// How a named set is layered in relation to the default, unnamed set.
+type layerMode int
+
+const (
+	// The default set takes precedence over the named set.
+	// This is how named sets originally worked.
+	layerUnder layerMode = iota
+	// The named set takes precedence over the sets bellow it,
+	// but events that it doesn't map fall through to those sets.
+	layerTransparent
+	// The named set takes precedence over the sets bellow it,
+	// and events that it doesn't map are simply ignored.
+	layerOpaque
+)
+
+func (kbEv *keyEvents) RegisterNamedLayer(name string, opaque bool) {
+	kbEv.RegisterNamedSet(name)
+
+	if opaque {
+		kbEv.setModes[name] = layerOpaque
+	} else {
+		kbEv.setModes[name] = layerTransparent
+	}
+}
+
+// activeSets lists the active named sets,
+// from the bottom of the stack (i.e., the currently active named set)
+// to its top (i.e., the most recently activated momentary layer).
+func (kbEv *keyEvents) activeSets() []string {
+	sets := make([]string, 0, len(kbEv.layers)+1)
+	if kbEv.curSet != "" {
+		sets = append(sets, kbEv.curSet)
+	}
+	return append(sets, kbEv.layers...)
+}
+
+// isSetActive checks whether the named set is somewhere in the stack of active sets.
+func (kbEv *keyEvents) isSetActive(name string) bool {
+	for _, set := range kbEv.activeSets() {
+		if set == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAction looks for the action associated with the event,
+// starting from the top of the stack of active sets.
+// Sets layered under the default set are only checked after the default set.
+func (kbEv *keyEvents) lookupAction(event noteEvent) (midiAction, bool) {
+	sets := kbEv.activeSets()
+
+	var under []string
+	for i := len(sets) - 1; i >= 0; i-- {
+		name := sets[i]
+
+		switch kbEv.setModes[name] {
+		case layerUnder:
+			under = append(under, name)
+			continue
+		case layerTransparent:
+			if action, ok := kbEv.namedSets[name][event]; ok {
+				return action.Action, true
+			}
+		case layerOpaque:
+			action, ok := kbEv.namedSets[name][event]
+			return action.Action, ok
+		}
+	}
+
+	if action, ok := kbEv.actions[event]; ok {
+		return action.Action, true
+	}
+
+	for _, name := range under {
+		if action, ok := kbEv.namedSets[name][event]; ok {
+			return action.Action, true
+		}
+	}
+
+	return nil, false
+}
+
+// registerActiveSets sends the actions of every active set to the event logger,
+// starting from the lowest priority one,
+// so each event ends up associated with the action that handles it.
+func (kbEv *keyEvents) registerActiveSets() {
+	sets := kbEv.activeSets()
+
+	for _, name := range sets {
+		if kbEv.setModes[name] == layerUnder {
+			kbEv.registerSet(kbEv.namedSets[name])
+		}
+	}
+	kbEv.registerSet(kbEv.actions)
+	for _, name := range sets {
+		if kbEv.setModes[name] != layerUnder {
+			kbEv.registerSet(kbEv.namedSets[name])
+		}
+	}
+}
+
+// registerSet sends the actions in the set to the event logger.
+func (kbEv *keyEvents) registerSet(set namedActionSet) {
+	for _, action := range set {
+		action.Register()
+	}
+}
+
+// activateSet executes the enter actions of the named set.
+func (kbEv *keyEvents) activateSet(name string) {
+	for _, action := range kbEv.enterActions[name] {
+		action()
+	}
+}
+
+// deactivateSet releases every key pressed by the named set,
+// stops anything left running by its actions and executes its exit actions,
+// unless the set is still active.
+func (kbEv *keyEvents) deactivateSet(name string) {
+	if kbEv.isSetActive(name) {
+		return
+	}
+
+	for _, keyAction := range kbEv.setKeyActions[name] {
+		if keyAction.IsPressed() {
+			keyAction.Release()
+		}
+	}
+
+	stopActions(kbEv.namedSets[name])
+
+	for _, action := range kbEv.exitActions[name] {
+		action()
+	}
+}
+
+func (kbEv *keyEvents) RegisterSetEnterAction(keyCode int, releaseTime time.Duration) {
+	action := kbEv.newSetAction(keyCode, releaseTime)
+	kbEv.enterActions[kbEv.curSet] = append(kbEv.enterActions[kbEv.curSet], action)
+}
+
+func (kbEv *keyEvents) RegisterSetExitAction(keyCode int, releaseTime time.Duration) {
+	action := kbEv.newSetAction(keyCode, releaseTime)
+	kbEv.exitActions[kbEv.curSet] = append(kbEv.exitActions[kbEv.curSet], action)
+}
+
+// newSetAction creates an action that presses a key and releases it after releaseTime.
+func (kbEv *keyEvents) newSetAction(keyCode int, releaseTime time.Duration) timerAction {
+	keyAction := kbEv.newKeyAction(keyCode, nil)
+
+	return func() {
+		keyAction.Press()
+		keyAction.QueueTimedAction(releaseTime)
+	}
+}
+
+// pushLayer activates the named set on top of every active set.
+func (kbEv *keyEvents) pushLayer(name string) {
+	wasActive := kbEv.isSetActive(name)
+
+	kbEv.layers = append(kbEv.layers, name)
+	if !wasActive {
+		kbEv.activateSet(name)
+	}
+	kbEv.registerActiveSets()
+}
+
+// removeLayer deactivates the named set previously activated with pushLayer,
+// even if other sets were activated on top of it since.
+func (kbEv *keyEvents) removeLayer(name string) {
+	for i := len(kbEv.layers) - 1; i >= 0; i-- {
+		if kbEv.layers[i] == name {
+			kbEv.layers = append(kbEv.layers[:i], kbEv.layers[i+1:]...)
+			break
+		}
+	}
+
+	kbEv.deactivateSet(name)
+	kbEv.registerActiveSets()
+}
+
+// captureEvent makes every following event be sent to action,
+// regardless of the active sets, until releaseEvent is called.
+// This guarantees that an action will receive the event that releases it
+// even if the active sets change (e.g., to an opaque layer).
+func (kbEv *keyEvents) captureEvent(event noteEvent, action midiAction) {
+	kbEv.captured[event] = action
+}
+
+// releaseEvent stops sending the event to the action set by captureEvent.
+func (kbEv *keyEvents) releaseEvent(event noteEvent) {
+	delete(kbEv.captured, event)
+}
@@ -0,0 +1,186 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestLayerPrecedence(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiShared = 2
+	const midiDefault = 3
+	const midiSwapSet = 4
+	const midiHoldLayer = 5
+	const keyDefault = 6
+	const keyShared = 7
+	const keyUnder = 8
+	const keyTransparent = 9
+	const keyOpaque = 10
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyDefault, keyShared, keyUnder, keyTransparent, keyOpaque)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// The default set maps both pads,
+	// and every other set maps only the shared pad.
+	ke.RegisterBasicPressAction(evType, channel, midiShared, keyShared, threshold, releaseTime)
+	ke.RegisterBasicPressAction(evType, channel, midiDefault, keyDefault, threshold, releaseTime)
+	ke.RegisterMapSwap(evType, channel, midiSwapSet, threshold, []string{"UNDER", "TRANSPARENT"})
+	ke.RegisterMomentaryMapping(evType, channel, midiHoldLayer, threshold, "OPAQUE")
+
+	ke.RegisterNamedSet("UNDER")
+	ke.RegisterBasicPressAction(evType, channel, midiShared, keyUnder, threshold, releaseTime)
+
+	ke.RegisterNamedLayer("TRANSPARENT", false)
+	ke.RegisterBasicPressAction(evType, channel, midiShared, keyTransparent, threshold, releaseTime)
+
+	ke.RegisterNamedLayer("OPAQUE", true)
+	ke.RegisterBasicPressAction(evType, channel, midiShared, keyOpaque, threshold, releaseTime)
+
+	ke.SetNamedSet("UNDER")
+
+	// assertPress checks that the midiKey presses keyCode.
+	assertPress := func(midiKey uint8, keyCode int) {
+		time.Sleep(time.Millisecond)
+		assertKeyEvent(t, kc, keyCode, evType, channel, midiKey, 100, conn, releaseTime, 10*time.Millisecond)
+	}
+
+	// Test that the default set takes precedence over a regular named set.
+	assertPress(midiShared, keyShared)
+	assertPress(midiDefault, keyDefault)
+
+	// Test that a transparent layer overrides the default set,
+	// but that other events fall through to the default set.
+	sendMidiEvent(evType, channel, midiSwapSet, 100, conn)
+	assertPress(midiShared, keyTransparent)
+	assertPress(midiDefault, keyDefault)
+
+	// Test that an opaque layer blocks every other event,
+	// but that it's still released by its own pad.
+	sendMidiEvent(evType, channel, midiHoldLayer, 100, conn)
+	assertPress(midiShared, keyOpaque)
+
+	sendMidiEvent(evType, channel, midiDefault, 100, conn)
+	select {
+	case <-kc[keyDefault].newState:
+		t.Fatalf("keyCode was pressed through an opaque layer")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	sendMidiEvent(midi.EventNoteOff, channel, midiHoldLayer, 0, conn)
+	assertPress(midiShared, keyTransparent)
+	assertPress(midiDefault, keyDefault)
+}
+
+func TestSetEnterExitActions(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiSwapSet = 2
+	const midiToggle = 3
+	const keyToggle = 4
+	const keyEnter = 5
+	const keyExit = 6
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+	const toggleThreshold = 80
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyToggle, keyEnter, keyExit)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterMapSwap(evType, channel, midiSwapSet, threshold, []string{"SET_A", "SET_B"})
+
+	ke.RegisterNamedSet("SET_A")
+	ke.RegisterToggleAction(evType, channel, midiToggle, keyToggle, threshold, toggleThreshold, releaseTime)
+	ke.RegisterSetExitAction(keyExit, releaseTime)
+
+	ke.RegisterNamedSet("SET_B")
+	ke.RegisterSetEnterAction(keyEnter, releaseTime)
+
+	ke.SetNamedSet("SET_A")
+
+	// Toggle the key on and swap the set,
+	// checking that the key is released and that the hooks are executed.
+	sendMidiEvent(evType, channel, midiToggle, toggleThreshold+1, conn)
+	assertKeyStates(t, kc[keyToggle], 10*time.Millisecond, true)
+
+	sendMidiEvent(evType, channel, midiSwapSet, 100, conn)
+	assertKeyStates(t, kc[keyToggle], 10*time.Millisecond, false)
+	assertKeyStates(t, kc[keyExit], 10*time.Millisecond, true)
+	assertKeyStates(t, kc[keyEnter], 10*time.Millisecond, true)
+	assertKeyStates(t, kc[keyExit], 2*releaseTime, false)
+	assertKeyStates(t, kc[keyEnter], 2*releaseTime, false)
+}
+
+func TestSetKeepsKeysOfOtherSets(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiSwapSet = 2
+	const midiToggle = 3
+	const midiTap = 4
+	const keyShift = 5
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+	const toggleThreshold = 80
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyShift)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// Both the default set and SET_A press the same key.
+	ke.RegisterMapSwap(evType, channel, midiSwapSet, threshold, []string{"SET_A", "SET_B"})
+	ke.RegisterToggleAction(evType, channel, midiToggle, keyShift, threshold, toggleThreshold, releaseTime)
+
+	ke.RegisterNamedSet("SET_A")
+	ke.RegisterBasicPressAction(evType, channel, midiTap, keyShift, threshold, releaseTime)
+
+	ke.RegisterNamedSet("SET_B")
+
+	ke.SetNamedSet("SET_A")
+
+	// Toggle the key on from the default set and leave SET_A,
+	// checking that the key is kept pressed.
+	sendMidiEvent(evType, channel, midiToggle, toggleThreshold+1, conn)
+	assertKeyStates(t, kc[keyShift], 10*time.Millisecond, true)
+
+	sendMidiEvent(evType, channel, midiSwapSet, 100, conn)
+	select {
+	case <-kc[keyShift].newState:
+		t.Fatalf("the key toggled by the default set was released by leaving SET_A")
+	case <-time.After(2 * releaseTime):
+	}
+
+	// Test that the default set may still release its own key.
+	sendMidiEvent(evType, channel, midiToggle, toggleThreshold+1, conn)
+	assertKeyStates(t, kc[keyShift], 10*time.Millisecond, false)
+}
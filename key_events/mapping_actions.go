@@ -0,0 +1,136 @@
+package key_events
+
+import (
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func (kbEv *keyEvents) RegisterMomentaryMapping(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	namedSet string,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	// Notes are released by a separated event.
+	var releaseEvent noteEvent
+	if evType == midi.EventNoteOn {
+		releaseEvent = generateNoteEvent(midi.EventNoteOff, channel, key)
+		kbEv.removeAction(releaseEvent)
+	}
+
+	// Whether the MIDI event is currently held.
+	var held bool
+
+	// Register the function that activates the set while the event is held,
+	// and that deactivates it once it's released.
+	var action midiAction
+	action = func(ev midi.MidiEvent) {
+		var isPress bool
+
+		switch ev.Type {
+		case midi.EventNoteOn:
+			// Some devices release notes by sending a Note On without any velocity.
+			if ev.Velocity == 0 {
+				isPress = false
+			} else if ev.Velocity > threshold {
+				isPress = true
+			} else {
+				return
+			}
+		case midi.EventNoteOff:
+			isPress = false
+		case midi.EventControlChange:
+			isPress = ev.Velocity > threshold
+		default:
+			return
+		}
+
+		if isPress && !held {
+			held = true
+			kbEv.pushLayer(namedSet)
+
+			// Make sure that the release is received even if the layer maps it.
+			kbEv.captureEvent(event, action)
+			if evType == midi.EventNoteOn {
+				kbEv.captureEvent(releaseEvent, action)
+			}
+			kbEv.el.SendMIDIEvent(channel, key)
+		} else if !isPress && held {
+			held = false
+			kbEv.releaseEvent(event)
+			if evType == midi.EventNoteOn {
+				kbEv.releaseEvent(releaseEvent)
+			}
+
+			kbEv.removeLayer(namedSet)
+		}
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "HOLD-MODE") }
+	kbEv.registerAction(event, action, register)
+	if evType == midi.EventNoteOn {
+		kbEv.registerAction(releaseEvent, action, func() {})
+	}
+}
+
+func (kbEv *keyEvents) RegisterMapSwapBack(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	namedSets []string,
+) {
+	kbEv.registerMapCycle(evType, channel, key, threshold, namedSets, -1, "PREV-MODE")
+}
+
+func (kbEv *keyEvents) RegisterMapSelect(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	namedSet string,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		kbEv.SetNamedSet(namedSet)
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "MODE:"+namedSet) }
+	kbEv.registerAction(event, action, register)
+}
+
+func (kbEv *keyEvents) RegisterMapReturn(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		if kbEv.lastSet != "" {
+			kbEv.SetNamedSet(kbEv.lastSet)
+		}
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "LAST-MODE") }
+	kbEv.registerAction(event, action, register)
+}
@@ -0,0 +1,170 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// newNamedSetsTest creates a KeyEvents with two named sets, SET_A and SET_B,
+// where midiNamedKey presses keyCodeA and keyCodeB, respectively.
+// setup is called before any named set is created,
+// and SET_A is activated at the end.
+func newNamedSetsTest(
+	t *testing.T,
+	conn chan midi.MidiEvent,
+	kc mockKeyController,
+	el event_logger.EventLogger,
+	midiNamedKey uint8,
+	keyCodeA,
+	keyCodeB int,
+	setup func(KeyEvents),
+) KeyEvents {
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+
+	setup(ke)
+
+	ke.RegisterNamedSet("SET_A")
+	ke.RegisterBasicPressAction(
+		midi.EventNoteOn,
+		1,
+		midiNamedKey,
+		keyCodeA,
+		threshold,
+		releaseTime,
+	)
+
+	ke.RegisterNamedSet("SET_B")
+	ke.RegisterBasicPressAction(
+		midi.EventNoteOn,
+		1,
+		midiNamedKey,
+		keyCodeB,
+		threshold,
+		releaseTime,
+	)
+
+	ke.SetNamedSet("SET_A")
+
+	return ke
+}
+
+func TestMomentaryMapping(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiHoldSet = 2
+	const ccHoldSet = 3
+	const midiNamedKey = 4
+	const keyCodeA = 5
+	const keyCodeB = 6
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCodeA, keyCodeB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke := newNamedSetsTest(t, conn, kc, el, midiNamedKey, keyCodeA, keyCodeB, func(ke KeyEvents) {
+		ke.RegisterMomentaryMapping(evType, channel, midiHoldSet, threshold, "SET_B")
+		ke.RegisterMomentaryMapping(midi.EventControlChange, channel, ccHoldSet, 63, "SET_B")
+	})
+	defer ke.Close()
+
+	for _, release := range []struct {
+		evType   midi.MidiEventType
+		velocity uint8
+	}{
+		{midi.EventNoteOff, 0},
+		{midi.EventNoteOn, 0},
+	} {
+		// Test that the set is active while the note is held.
+		sendMidiEvent(evType, channel, midiHoldSet, 100, conn)
+		time.Sleep(time.Millisecond)
+
+		assertKeyEvent(t, kc, keyCodeB, evType, channel, midiNamedKey, 100, conn, releaseTime, 10*time.Millisecond)
+
+		// Test that the previous set is restored once the note is released.
+		sendMidiEvent(release.evType, channel, midiHoldSet, release.velocity, conn)
+		time.Sleep(time.Millisecond)
+
+		assertKeyEvent(t, kc, keyCodeA, evType, channel, midiNamedKey, 100, conn, releaseTime, 10*time.Millisecond)
+	}
+
+	// Test that the set is active while the controller is pressed.
+	sendMidiEvent(midi.EventControlChange, channel, ccHoldSet, 127, conn)
+	sendMidiEvent(midi.EventControlChange, channel, ccHoldSet, 100, conn)
+	time.Sleep(time.Millisecond)
+
+	assertKeyEvent(t, kc, keyCodeB, evType, channel, midiNamedKey, 100, conn, releaseTime, 10*time.Millisecond)
+
+	sendMidiEvent(midi.EventControlChange, channel, ccHoldSet, 0, conn)
+	time.Sleep(time.Millisecond)
+
+	assertKeyEvent(t, kc, keyCodeA, evType, channel, midiNamedKey, 100, conn, releaseTime, 10*time.Millisecond)
+}
+
+func TestSelectNamedSet(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiSelectA = 2
+	const midiSelectB = 3
+	const midiPrevSet = 4
+	const midiLastSet = 5
+	const midiNamedKey = 6
+	const keyCodeA = 7
+	const keyCodeB = 8
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCodeA, keyCodeB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke := newNamedSetsTest(t, conn, kc, el, midiNamedKey, keyCodeA, keyCodeB, func(ke KeyEvents) {
+		ke.RegisterMapSelect(evType, channel, midiSelectA, threshold, "SET_A")
+		ke.RegisterMapSelect(evType, channel, midiSelectB, threshold, "SET_B")
+		ke.RegisterMapSwapBack(evType, channel, midiPrevSet, threshold, []string{"SET_A", "SET_B"})
+		ke.RegisterMapReturn(evType, channel, midiLastSet, threshold)
+	})
+	defer ke.Close()
+
+	// assertSet checks that the active set is the one that presses keyCode.
+	assertSet := func(keyCode int) {
+		time.Sleep(time.Millisecond)
+		assertKeyEvent(t, kc, keyCode, evType, channel, midiNamedKey, 100, conn, releaseTime, 10*time.Millisecond)
+	}
+
+	// Test that selecting a set directly activates it, even if already active.
+	sendMidiEvent(evType, channel, midiSelectB, 100, conn)
+	assertSet(keyCodeB)
+	sendMidiEvent(evType, channel, midiSelectB, 100, conn)
+	assertSet(keyCodeB)
+	sendMidiEvent(evType, channel, midiSelectA, 100, conn)
+	assertSet(keyCodeA)
+
+	// Test that going back wraps around.
+	sendMidiEvent(evType, channel, midiPrevSet, 100, conn)
+	assertSet(keyCodeB)
+	sendMidiEvent(evType, channel, midiPrevSet, 100, conn)
+	assertSet(keyCodeA)
+
+	// Test that returning to the last set toggles between the two last sets.
+	sendMidiEvent(evType, channel, midiLastSet, 100, conn)
+	assertSet(keyCodeB)
+	sendMidiEvent(evType, channel, midiLastSet, 100, conn)
+	assertSet(keyCodeA)
+}
@@ -0,0 +1,63 @@
+package key_events
+
+import (
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// stopActions stops anything left running by the actions in set.
+func stopActions(set namedActionSet) {
+	for _, action := range set {
+		if action.Stop != nil {
+			action.Stop()
+		}
+	}
+}
+
+// stopAll stops anything left running by every action, in every set.
+func (kbEv *keyEvents) stopAll() {
+	stopActions(kbEv.actions)
+	for _, set := range kbEv.namedSets {
+		stopActions(set)
+	}
+}
+
+// resetAll releases every key and resets every action back to its initial state.
+func (kbEv *keyEvents) resetAll() {
+	kbEv.stopAll()
+	for _, reset := range kbEv.resetActions {
+		reset()
+	}
+
+	for _, keyAction := range kbEv.keyActions {
+		if keyAction.IsPressed() {
+			keyAction.Release()
+		}
+	}
+	// Release anything that may have been left pressed by the actions.
+	kbEv.keys.ReleaseAll()
+
+	kbEv.registerActiveSets()
+}
+
+func (kbEv *keyEvents) RegisterPanicAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		kbEv.resetAll()
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "PANIC") }
+	kbEv.registerAction(event, action, register)
+}
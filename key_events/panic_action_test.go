@@ -0,0 +1,110 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestPanicAction(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiPanic = 2
+	const midiToggle = 3
+	const midiTurbo = 4
+	const midiPress = 5
+	const midiNext = 6
+	const midiPrev = 7
+	const midiReset = 8
+	const keyToggle = 9
+	const keyTurbo = 10
+	const keyFirst = 11
+	const keySecond = 12
+	const releaseTime = 20 * time.Millisecond
+	const period = 40 * time.Millisecond
+	const threshold = 30
+	const toggleThreshold = 80
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyToggle, keyTurbo, keyFirst, keySecond)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterPanicAction(evType, channel, midiPanic, threshold)
+	ke.RegisterToggleAction(evType, channel, midiToggle, keyToggle, threshold, toggleThreshold, releaseTime)
+	ke.RegisterTurboAction(evType, channel, midiTurbo, keyTurbo, threshold, period, period)
+	ke.RegisterSequenceHoldAction(
+		evType,
+		channel,
+		midiPress,
+		[][]int{[]int{keyFirst}, []int{keySecond}},
+		threshold,
+		100,
+		releaseTime,
+		midiPrev,
+		midiNext,
+		midiReset,
+	)
+
+	// Toggle a key on, start the turbo and advance the sequence.
+	sendMidiEvent(evType, channel, midiToggle, toggleThreshold+1, conn)
+	assertKeyStates(t, kc[keyToggle], 10*time.Millisecond, true)
+	sendMidiEvent(evType, channel, midiTurbo, 100, conn)
+	assertKeyStates(t, kc[keyTurbo], 10*time.Millisecond, true)
+	sendMidiEvent(evType, channel, midiNext, 100, conn)
+
+	// Test that everything gets released and reset.
+	sendMidiEvent(evType, channel, midiPanic, 100, conn)
+	assertKeyStates(t, kc[keyToggle], 10*time.Millisecond, false)
+	assertKeyStops(t, kc[keyTurbo], 2*period)
+
+	assertKeyEvent(t, kc, keyFirst, evType, channel, midiPress, 100, conn, releaseTime, 10*time.Millisecond)
+}
+
+func TestCloseReleasesKeys(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiToggle = 2
+	const midiTurbo = 3
+	const keyToggle = 4
+	const keyTurbo = 5
+	const releaseTime = 20 * time.Millisecond
+	const period = 40 * time.Millisecond
+	const threshold = 30
+	const toggleThreshold = 80
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyToggle, keyTurbo)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+
+	ke.RegisterToggleAction(evType, channel, midiToggle, keyToggle, threshold, toggleThreshold, releaseTime)
+	ke.RegisterTurboAction(evType, channel, midiTurbo, keyTurbo, threshold, period, period)
+
+	sendMidiEvent(evType, channel, midiToggle, toggleThreshold+1, conn)
+	assertKeyStates(t, kc[keyToggle], 10*time.Millisecond, true)
+	sendMidiEvent(evType, channel, midiTurbo, 100, conn)
+	assertKeyStates(t, kc[keyTurbo], 10*time.Millisecond, true)
+
+	// Test that closing the generator releases every key.
+	closed := make(chan error, 1)
+	go func() { closed <- ke.Close() }()
+	assertKeyStates(t, kc[keyToggle], 10*time.Millisecond, false)
+	assertKeyStops(t, kc[keyTurbo], 2*period)
+	assert(t, <-closed == nil, "Failed to close the key event generator")
+}
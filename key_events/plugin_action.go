@@ -0,0 +1,319 @@
+package key_events
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// How many MIDI events may be queued for a plugin.
+// Events received while the queue is full are dropped.
+const pluginQueueSize = 64
+
+// How long to wait before restarting a plugin that exited.
+const pluginRestartDelay = 500 * time.Millisecond
+
+// A MIDI event sent to a plugin, as a single line of JSON.
+type pluginEvent struct {
+	// The event's type (e.g., "note-on").
+	Type string `json:"type"`
+	// The event's channel.
+	Channel uint8 `json:"channel"`
+	// The event's key.
+	Key uint8 `json:"key"`
+	// The event's velocity.
+	Velocity uint8 `json:"velocity"`
+	// When the event was received, in milliseconds.
+	Timestamp int32 `json:"timestamp"`
+}
+
+// A command received from a plugin, as a single line of JSON.
+type pluginCommand struct {
+	// What the command does: "press", "release", "tap" or "use".
+	Cmd string `json:"cmd"`
+	// The keys pressed/released by the command, by their names.
+	Keys []string `json:"keys"`
+	// For how long tapped keys are held, in milliseconds.
+	Ms int `json:"ms"`
+	// The named set activated by the command.
+	Set string `json:"set"`
+}
+
+// An external process that receives MIDI events on its stdin
+// and replies with commands on its stdout, one JSON per line.
+// The process is restarted whenever it exits.
+type plugin struct {
+	// The plugin's name, used in logs.
+	name string
+	// The command (and its arguments) that starts the plugin.
+	command []string
+	// The key events generator executing the plugin's commands.
+	kbEv *keyEvents
+	// Queue MIDI events to be sent to the plugin.
+	events chan pluginEvent
+	// Closed to signal that the plugin should be stopped forever.
+	done chan struct{}
+	// Synchronizes access to cmd.
+	mutex sync.Mutex
+	// The plugin's current process, if running.
+	cmd *exec.Cmd
+	// The handle used to execute the plugin's commands.
+	// Must only be accessed from the main thread.
+	handle *actionHandle
+}
+
+// newPlugin creates a new plugin and starts its process in the background,
+// unless the config is only being checked.
+func newPlugin(kbEv *keyEvents, name string, command []string) *plugin {
+	p := &plugin{
+		name:    name,
+		command: command,
+		kbEv:    kbEv,
+		events:  make(chan pluginEvent, pluginQueueSize),
+		done:    make(chan struct{}),
+		handle:  kbEv.newActionHandle(),
+	}
+	if !kbEv.dryRun {
+		go p.run()
+	}
+
+	return p
+}
+
+// run keeps the plugin running, restarting it whenever it exits, until it's closed.
+func (p *plugin) run() {
+	for {
+		p.runOnce()
+
+		select {
+		case <-p.done:
+			return
+		case <-time.After(pluginRestartDelay):
+		}
+		log.Printf("plugin: restarting '%s'", p.name)
+	}
+}
+
+// runOnce starts the plugin's process, forwarding MIDI events to it
+// until it exits (or until the plugin gets closed).
+func (p *plugin) runOnce() {
+	cmd := exec.Command(p.command[0], p.command[1:]...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Printf("plugin: failed to start '%s': %+v", p.name, err)
+		return
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Printf("plugin: failed to start '%s': %+v", p.name, err)
+		return
+	}
+
+	p.mutex.Lock()
+	select {
+	case <-p.done:
+		// Don't start the process if the plugin was closed in the meantime.
+		p.mutex.Unlock()
+		return
+	default:
+	}
+	err = cmd.Start()
+	if err == nil {
+		p.cmd = cmd
+	}
+	p.mutex.Unlock()
+	if err != nil {
+		log.Printf("plugin: failed to start '%s': %+v", p.name, err)
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		p.read(stdout)
+		close(exited)
+	}()
+
+	encoder := json.NewEncoder(stdin)
+	for running := true; running; {
+		select {
+		case ev := <-p.events:
+			// Write errors mean that the process exited,
+			// which is detected once its stdout gets closed.
+			encoder.Encode(&ev)
+		case <-exited:
+			running = false
+		}
+	}
+
+	stdin.Close()
+	err = cmd.Wait()
+	p.mutex.Lock()
+	p.cmd = nil
+	p.mutex.Unlock()
+
+	select {
+	case <-p.done:
+	default:
+		log.Printf("plugin: '%s' exited: %+v", p.name, err)
+	}
+}
+
+// read reads the plugin's commands until its stdout gets closed,
+// queueing them to be executed on the main thread, unless the plugin gets closed in the meantime.
+func (p *plugin) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var command pluginCommand
+		if err := json.Unmarshal(scanner.Bytes(), &command); err != nil {
+			log.Printf("plugin: invalid command from '%s': %+v", p.name, err)
+			continue
+		}
+
+		action, err := p.parseCommand(command)
+		if err != nil {
+			log.Printf("plugin: invalid command from '%s': %+v", p.name, err)
+			continue
+		}
+
+		queued := func() {
+			// Drop commands from closed plugins (e.g., replaced by a reload),
+			// so they don't press keys that would never be released.
+			select {
+			case <-p.done:
+			default:
+				action()
+			}
+		}
+
+		select {
+		case p.kbEv.timedAction <- queued:
+		case <-p.done:
+			return
+		case <-p.kbEv.done:
+			return
+		}
+	}
+}
+
+// parseCommand converts a plugin's command into the action that executes it.
+func (p *plugin) parseCommand(command pluginCommand) (timerAction, error) {
+	var keyCodes []int
+	for _, name := range command.Keys {
+		keyCode, ok := keyNameToInt[strings.ToUpper(name)]
+		if !ok || keyCode == -1 {
+			log.Printf("invalid key: '%s'", name)
+			return nil, ErrPluginCommandInvalid
+		}
+		keyCodes = append(keyCodes, keyCode)
+	}
+
+	switch command.Cmd {
+	case "press":
+		return func() { p.handle.PressKeys(keyCodes) }, nil
+	case "release":
+		return func() { p.handle.ReleaseKeys(keyCodes) }, nil
+	case "tap":
+		releaseTime := time.Duration(command.Ms) * time.Millisecond
+		if releaseTime <= 0 {
+			return nil, ErrPluginCommandInvalid
+		}
+
+		return func() { p.handle.TapKeys(keyCodes, releaseTime) }, nil
+	case "use":
+		if command.Set == "" {
+			return nil, ErrPluginCommandInvalid
+		}
+
+		return func() { p.handle.UseSet(command.Set) }, nil
+	default:
+		return nil, ErrPluginCommandInvalid
+	}
+}
+
+// Send queues a MIDI event to be sent to the plugin.
+// If the plugin isn't keeping up, the event is dropped, so it never blocks the caller.
+func (p *plugin) Send(ev midi.MidiEvent) {
+	msg := pluginEvent{
+		Type:      "note-on",
+		Channel:   ev.Channel,
+		Key:       ev.Key,
+		Velocity:  ev.Velocity,
+		Timestamp: ev.Timestamp,
+	}
+
+	select {
+	case p.events <- msg:
+	default:
+		log.Printf("plugin: dropping event for '%s', which isn't keeping up", p.name)
+	}
+}
+
+// Close stops the plugin forever, killing its process.
+// Its keys are released once the key events generator gets closed.
+func (p *plugin) Close() error {
+	select {
+	// If the plugin was already closed, simply exit.
+	case <-p.done:
+		return nil
+	default:
+	}
+
+	p.mutex.Lock()
+	close(p.done)
+	if p.cmd != nil {
+		p.cmd.Process.Kill()
+	}
+	p.mutex.Unlock()
+
+	return nil
+}
+
+func (kbEv *keyEvents) RegisterPlugin(name string, command []string) {
+	if prev, ok := kbEv.plugins[name]; ok {
+		prev.Close()
+	}
+
+	p := newPlugin(kbEv, name, command)
+	kbEv.plugins[name] = p
+	kbEv.resetActions = append(kbEv.resetActions, p.handle.releaseKeys)
+}
+
+func (kbEv *keyEvents) RegisterPluginAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	name string,
+) {
+	p, ok := kbEv.plugins[name]
+	if !ok {
+		log.Printf("plugin: ignoring unknown plugin '%s'", name)
+		return
+	}
+
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		p.Send(ev)
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "PLUGIN:"+name) }
+	kbEv.registerAction(event, action, register)
+}
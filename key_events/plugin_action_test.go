@@ -0,0 +1,116 @@
+package key_events
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestPluginAction(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("test requires a POSIX shell")
+	}
+
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const threshold = 30
+	keyCode := keyNameToInt["A"]
+
+	// Tap 'A' on hard hits, and crash on anything else.
+	plugin := `
+while read -r line; do
+	case "$line" in
+	*'"velocity":100'*) echo '{"cmd":"tap","keys":["A"],"ms":20}' ;;
+	*) exit 1 ;;
+	esac
+done
+`
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterPlugin("tap", []string{"sh", "-c", plugin})
+	ke.RegisterPluginAction(evType, channel, midiKey, threshold, "tap")
+
+	// Test that the input is ignored bellow the threshold.
+	sendMidiEvent(evType, channel, midiKey, threshold, conn)
+	assertKeyStates(t, kc[keyCode], 0)
+
+	// Test that the plugin's commands are executed.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyCode], time.Second, true, false)
+
+	// Test that the plugin is restarted after crashing.
+	sendMidiEvent(evType, channel, midiKey, 60, conn)
+	time.Sleep(pluginRestartDelay + 200*time.Millisecond)
+
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyCode], time.Second, true, false)
+}
+
+func TestPluginCommandAfterReload(t *testing.T) {
+	keyCode := keyNameToInt["A"]
+
+	conn := make(chan midi.MidiEvent)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	// Don't start the main thread nor the plugin's process,
+	// so the command can be executed only after the config gets reloaded.
+	kbEv := newKeyEvents(kc, conn, false, el)
+	kbEv.dryRun = true
+	kbEv.RegisterPlugin("press", []string{"sh"})
+
+	go kbEv.plugins["press"].read(strings.NewReader(`{"cmd":"press","keys":["A"]}` + "\n"))
+	action := <-kbEv.timedAction
+
+	path := filepath.Join(t.TempDir(), "config.txt")
+	err := os.WriteFile(path, []byte("ch=9 ev=0x24 key=A thres=0 BASIC 20\n"), 0644)
+	assert(t, err == nil, "Failed to write the config: %+v", err)
+	err = kbEv.reloadConfig(path)
+	assert(t, err == nil, "Failed to reload the config: %+v", err)
+
+	// Test that the command queued by the replaced plugin is dropped.
+	action()
+	assert(t, !kbEv.IsKeyHeld(keyCode), "'A' shouldn't be held by the new mappings")
+	assert(t, len(kc[keyCode].newState) == 0, "'A' shouldn't have been pressed")
+
+	go kbEv.run()
+	err = kbEv.Close()
+	assert(t, err == nil, "Failed to close the key event generator: %+v", err)
+}
+
+func TestPluginCommandInvalid(t *testing.T) {
+	p := &plugin{name: "test"}
+
+	for _, command := range []pluginCommand{
+		{Cmd: "press", Keys: []string{"NOT-A-KEY"}},
+		{Cmd: "press", Keys: []string{"NONE"}},
+		{Cmd: "tap", Keys: []string{"A"}},
+		{Cmd: "use"},
+		{Cmd: "exec"},
+	} {
+		_, err := p.parseCommand(command)
+		assert(t, err == ErrPluginCommandInvalid, "command %+v should be invalid, got: %+v", command, err)
+	}
+}
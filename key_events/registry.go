@@ -0,0 +1,145 @@
+package key_events
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// The kind of value expected by an argument of a custom action.
+type ArgKind int
+
+const (
+	// A positive integer (e.g., "100" or "0x2d").
+	ArgInt ArgKind = iota
+	// A string, written as "str=VALUE".
+	// If it's the last argument, the string extends until the end of the line.
+	ArgString
+)
+
+// The action taken (e.g., generate a key press) in response to a MIDI event.
+// MIDI actions are always called from the goroutine handling MIDI events.
+type MidiAction func(ev midi.MidiEvent)
+
+// The values parsed from a config line for a custom action.
+type ActionArgs struct {
+	// The MIDI event's type (e.g., midi.EventNoteOn).
+	EvType midi.MidiEventType
+	// The MIDI event's channel ("ch=").
+	Channel uint8
+	// The MIDI event's key ("ev=").
+	Key uint8
+	// The keyboard key ("key="), which is -1 for 'NONE'.
+	KeyCode int
+	// The threshold ("thres="), which the action must check by itself.
+	Threshold uint8
+	// The action's ArgInt arguments, in order.
+	Ints []int
+	// The action's ArgString arguments, in order, without their "str=" prefix.
+	Strings []string
+}
+
+// Creates a custom action for a config line.
+// handle is used by the action to press/release keys, queue functions and switch named sets,
+// and it gets stopped (i.e., its keys released and its queued functions cancelled)
+// if the action's named set gets deactivated.
+// Invalid arguments should be reported by returning an error.
+type ActionConstructor func(handle ActionHandle, args ActionArgs) (MidiAction, error)
+
+// Describes a custom action type.
+type actionType struct {
+	// The kind of each of the action's arguments.
+	args []ArgKind
+	// Creates the action for a config line.
+	constructor ActionConstructor
+}
+
+var (
+	// Synchronizes access to actionTypes.
+	actionTypesMutex sync.Mutex
+	// The custom action types, by their names.
+	actionTypes = make(map[string]actionType)
+)
+
+// RegisterActionType registers a custom action type, which may then be used in config files
+// exactly like the built-in actions (e.g., "ch=9 ev=0x24 key=A thres=30 NAME 100 str=foo").
+// Each line using the action calls constructor, with the line's arguments parsed according to args.
+//
+// Action types are shared by every KeyEvents, so they are usually registered
+// in an init function, before reading any config file.
+// Returns ErrActionTypeExists if the name is already used by another action,
+// built-in or not, and ErrActionTypeInvalid if the name or the constructor are invalid.
+func RegisterActionType(name string, args []ArgKind, constructor ActionConstructor) error {
+	if name == "" || strings.ContainsAny(name, " \t") || constructor == nil {
+		return ErrActionTypeInvalid
+	}
+
+	actionTypesMutex.Lock()
+	defer actionTypesMutex.Unlock()
+
+	if _, ok := actionsToArgCount[name]; ok {
+		return ErrActionTypeExists
+	} else if _, ok := actionTypes[name]; ok {
+		return ErrActionTypeExists
+	}
+
+	actionTypes[name] = actionType{
+		args:        append([]ArgKind(nil), args...),
+		constructor: constructor,
+	}
+	return nil
+}
+
+// lookupActionType returns the custom action type called name, if any.
+func lookupActionType(name string) (actionType, bool) {
+	actionTypesMutex.Lock()
+	defer actionTypesMutex.Unlock()
+
+	typ, ok := actionTypes[name]
+	return typ, ok
+}
+
+// parseArgs splits the arguments of a config line into ActionArgs, based on their kinds.
+// Integers were already parsed into numArgs, while the strings are read from rawArgs.
+func (typ actionType) parseArgs(rawArgs []string, numArgs []int) ([]int, []string, error) {
+	var ints []int
+	var strs []string
+
+	for i, kind := range typ.args {
+		isString := strings.HasPrefix(rawArgs[i], "str=")
+
+		switch {
+		case kind == ArgString && isString:
+			strs = append(strs, strings.TrimPrefix(rawArgs[i], "str="))
+		case kind == ArgInt && !isString:
+			ints = append(ints, numArgs[i])
+		default:
+			return nil, nil, ErrConfigActionArgumentInvalid
+		}
+	}
+
+	return ints, strs, nil
+}
+
+// registerCustomAction creates an action of the custom action type
+// and registers it to the MIDI event in args.
+func (kbEv *keyEvents) registerCustomAction(name string, typ actionType, args ActionArgs) error {
+	handle := kbEv.newActionHandle()
+
+	action, err := typ.constructor(handle, args)
+	if err != nil {
+		return err
+	} else if action == nil {
+		return ErrActionTypeInvalid
+	}
+
+	event := generateNoteEvent(args.EvType, args.Channel, args.Key)
+	kbEv.removeAction(event)
+
+	channel, key := args.Channel, args.Key
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, name) }
+	kbEv.registerStoppableAction(event, midiAction(action), register, handle.stop)
+
+	return nil
+}
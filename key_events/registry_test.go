@@ -0,0 +1,115 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// newTestTapAction creates an action that taps every key listed in its string argument,
+// releasing them after its integer argument, in milliseconds.
+func newTestTapAction(handle ActionHandle, args ActionArgs) (MidiAction, error) {
+	var keyCodes []int
+	for _, name := range strings.Split(args.Strings[0], ",") {
+		keyCode, ok := keyNameToInt[name]
+		if !ok {
+			return nil, errors.New("invalid key: " + name)
+		}
+		keyCodes = append(keyCodes, keyCode)
+	}
+	releaseTime := time.Duration(args.Ints[0]) * time.Millisecond
+
+	return func(ev midi.MidiEvent) {
+		if ev.Type == midi.EventNoteOn && ev.Velocity > args.Threshold {
+			handle.TapKeys(keyCodes, releaseTime)
+		}
+	}, nil
+}
+
+func init() {
+	err := RegisterActionType("TEST-TAP", []ArgKind{ArgInt, ArgString}, newTestTapAction)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterActionType(t *testing.T) {
+	err := RegisterActionType("TEST-TAP", nil, newTestTapAction)
+	assert(t, err == ErrActionTypeExists, "re-registering an action type should fail, got: %+v", err)
+
+	err = RegisterActionType("BASIC", nil, newTestTapAction)
+	assert(t, err == ErrActionTypeExists, "overriding a built-in action should fail, got: %+v", err)
+
+	err = RegisterActionType("TEST TAP", nil, newTestTapAction)
+	assert(t, err == ErrActionTypeInvalid, "names with spaces should be invalid, got: %+v", err)
+
+	err = RegisterActionType("TEST-NIL", nil, nil)
+	assert(t, err == ErrActionTypeInvalid, "action types without a constructor should be invalid, got: %+v", err)
+}
+
+func TestCustomActionConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	const midiKey = 0x24
+	keyCode := keyNameToInt["A"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// readConfig writes the config to a file and reads it.
+	readConfig := func(config string) error {
+		path := filepath.Join(t.TempDir(), "config.txt")
+		err := os.WriteFile(path, []byte(config), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+
+		return ke.ReadConfig(path)
+	}
+
+	err = readConfig("ch=9 ev=0x24 key=NONE thres=30 TEST-TAP 20 str=A\n")
+	assert(t, err == nil, "Failed to read the config: %+v", err)
+
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyCode], 40*time.Millisecond, true, false)
+
+	// Test that the arguments are checked.
+	for _, config := range []string{
+		"ch=9 ev=0x25 key=NONE thres=30 TEST-TAP str=A 20\n",
+		"ch=9 ev=0x25 key=NONE thres=30 TEST-TAP 20\n",
+		"ch=9 ev=0x25 key=NONE thres=30 TEST-TAP 20 str=NOT-A-KEY\n",
+	} {
+		err := readConfig(config)
+		assert(t, errors.Is(err, ErrConfigActionArgumentInvalid) || errors.Is(err, ErrConfigArgsBad), "config '%s' should be invalid, got: %+v", config, err)
+	}
+}
+
+func TestActionHandleAfterClose(t *testing.T) {
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke := newKeyEvents(NewMockKeyController(), nil, false, el)
+	go ke.run()
+	defer ke.Close()
+
+	// Test that functions queued before the handle is closed (e.g., by a reload) are dropped,
+	// instead of being sent to the main thread.
+	h := ke.newActionHandle()
+	h.After(time.Millisecond, func() {})
+	h.Close()
+	time.Sleep(10 * time.Millisecond)
+	assert(t, len(ke.timedAction) == 0, "the canceled function shouldn't have been queued")
+}
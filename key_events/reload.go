@@ -0,0 +1,50 @@
+package key_events
+
+// A request to reload the config file, handled by the main thread.
+type configReload struct {
+	// The config file.
+	path string
+	// Receives the result of reloading the config file.
+	done chan error
+}
+
+func (kbEv *keyEvents) ReloadConfig(path string) error {
+	done := make(chan error, 1)
+	select {
+	case kbEv.reloads <- configReload{path: path, done: done}:
+	case <-kbEv.done:
+		return ErrKeyEventsClosed
+	}
+
+	return <-done
+}
+
+// reloadConfig reads the config file in path into a fresh mapping table,
+// swapping it with the current one if the file doesn't have any problem.
+// The current mappings are left untouched (e.g., their keys stay pressed) until the file is fully read,
+// and the initial named set of the new mappings is only activated after they replace the current ones.
+//
+// Must be called from the main thread, so no event is handled while the mappings are swapped.
+func (kbEv *keyEvents) reloadConfig(path string) error {
+	prev := kbEv.mappingTable
+	kbEv.mappingTable = newMappingTable(kbEv.kc)
+
+	state := kbEv.newConfigState()
+	kbEv.readConfig(state, path)
+	kbEv.restoreConfigState(state)
+	if err := state.err(); err != nil {
+		// Keep the previous mappings, discarding whatever was already read.
+		kbEv.closeMappings()
+		kbEv.mappingTable = prev
+		return err
+	}
+
+	// Release every key held by the mappings being replaced, so no key is left pressed.
+	next := kbEv.mappingTable
+	kbEv.mappingTable = prev
+	kbEv.closeMappings()
+	kbEv.mappingTable = next
+	kbEv.SetNamedSet(state.initialSet)
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package key_events
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestReloadConfig(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 9
+	const midiKey = 0x24
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	path := filepath.Join(t.TempDir(), "config.txt")
+	writeConfig := func(config string) {
+		err := os.WriteFile(path, []byte(config+"\n"), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+	}
+
+	// Toggle 'A', leaving it pressed.
+	writeConfig("ch=9 ev=0x24 key=A thres=0 TOGGLE 1 10")
+	err = ke.ReadConfig(path)
+	assert(t, err == nil, "Failed to read the config: %+v", err)
+
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyA], 20*time.Millisecond, true)
+
+	// Test that a config with problems doesn't release the held keys.
+	writeConfig("ch=16 ev=0x24 key=B thres=0 BASIC 20")
+	err = ke.ReloadConfig(path)
+	assert(t, errors.Is(err, ErrConfigChannelTokenInvalid), "expected the reload to fail, got: %+v", err)
+	assert(t, len(kc[keyA].newState) == 0 && kc[keyA].state, "'A' should still be pressed")
+
+	// Test that reloading the config releases 'A', and maps the event to 'B' instead.
+	writeConfig("ch=9 ev=0x24 key=B thres=0 BASIC 20")
+	err = ke.ReloadConfig(path)
+	assert(t, err == nil, "Failed to reload the config: %+v", err)
+	assertKeyStates(t, kc[keyA], 20*time.Millisecond, false)
+
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+	assert(t, len(kc[keyA].newState) == 0, "'A' shouldn't be pressed anymore")
+
+	// Test that a config with problems keeps the previous mappings.
+	writeConfig("ch=9 ev=0x24 key=A thres=0 BASIC 20\nch=16 ev=0x25 key=A thres=0 BASIC 20")
+	err = ke.ReloadConfig(path)
+	assert(t, errors.Is(err, ErrConfigChannelTokenInvalid), "expected the reload to fail, got: %+v", err)
+
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+	assert(t, len(kc[keyA].newState) == 0, "the config with problems shouldn't have been used")
+
+	// Test that reloading the config fails, instead of blocking, once the generator is closed.
+	err = ke.Close()
+	assert(t, err == nil, "Failed to close the key event generator: %+v", err)
+	err = ke.ReloadConfig(path)
+	assert(t, errors.Is(err, ErrKeyEventsClosed), "expected the reload to fail, got: %+v", err)
+}
+
+func TestReloadConfigInitialSet(t *testing.T) {
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	path := filepath.Join(t.TempDir(), "config.txt")
+	writeConfig := func(config string) {
+		err := os.WriteFile(path, []byte(config+"\n"), 0644)
+		assert(t, err == nil, "Failed to write the config: %+v", err)
+	}
+
+	// Toggle 'A', leaving it pressed.
+	writeConfig("ch=9 ev=0x24 key=A thres=0 TOGGLE 1 10")
+	err = ke.ReadConfig(path)
+	assert(t, err == nil, "Failed to read the config: %+v", err)
+
+	sendMidiEvent(midi.EventNoteOn, 9, 0x24, 100, conn)
+	assertKeyStates(t, kc[keyA], 20*time.Millisecond, true)
+
+	// The initial set taps 'B' when it's activated.
+	config := "ch=9 ev=0x25 key=NONE thres=0 USE-MAPPING str=SET_B,SET_C\n" +
+		"ch=0 ev=0 key=NONE thres=0 NEW-MAPPING str=SET_B\n" +
+		"ch=0 ev=0 key=B thres=0 ON-ENTER 20\n" +
+		"ch=0 ev=0 key=NONE thres=0 NEW-MAPPING str=SET_C"
+
+	// Test that a config with problems doesn't activate its initial set.
+	writeConfig(config + "\nch=16 ev=0x24 key=B thres=0 BASIC 20")
+	err = ke.ReloadConfig(path)
+	assert(t, errors.Is(err, ErrConfigChannelTokenInvalid), "expected the reload to fail, got: %+v", err)
+	time.Sleep(40 * time.Millisecond)
+	assert(t, len(kc[keyB].newState) == 0, "'B' shouldn't have been pressed")
+	assert(t, len(kc[keyA].newState) == 0 && kc[keyA].state, "'A' should still be pressed")
+
+	// Test that the initial set is only activated after the previous mappings are released.
+	writeConfig(config)
+	err = ke.ReloadConfig(path)
+	assert(t, err == nil, "Failed to reload the config: %+v", err)
+	assertKeyStates(t, kc[keyA], 20*time.Millisecond, false)
+	assertKeyStates(t, kc[keyB], 40*time.Millisecond, true, false)
+}
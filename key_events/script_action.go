@@ -0,0 +1,63 @@
+package key_events
+
+import (
+	"log"
+	"os"
+
+	"github.com/SirGFM/midi-go-key/err_wrap"
+	"github.com/SirGFM/midi-go-key/midi"
+	"github.com/SirGFM/midi-go-key/script"
+)
+
+// loadScript compiles the script in path, or returns the script previously compiled from it,
+// so every action bound to the same script shares its variables.
+func (kbEv *keyEvents) loadScript(path string) (*script.Program, error) {
+	if program, ok := kbEv.scripts[path]; ok {
+		return program, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err_wrap.Wrap(err, ErrConfigScriptInvalid)
+	}
+
+	program, err := script.Compile(string(src), keyNameToInt)
+	if err != nil {
+		return nil, err_wrap.Wrap(err, ErrConfigScriptInvalid)
+	}
+
+	kbEv.scripts[path] = program
+	kbEv.resetActions = append(kbEv.resetActions, program.Reset)
+	return program, nil
+}
+
+func (kbEv *keyEvents) RegisterScriptAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	program *script.Program,
+	function string,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	// Every binding of the script presses its keys through its own handle,
+	// so stopping the action only releases the keys that it pressed.
+	handle := kbEv.newActionHandle()
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		if err := program.Call(function, ev, handle); err != nil {
+			log.Printf("script: %+v", err)
+		}
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "SCRIPT:"+function) }
+	kbEv.registerStoppableAction(event, action, register, handle.stop)
+}
@@ -0,0 +1,122 @@
+package key_events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+	"github.com/SirGFM/midi-go-key/script"
+)
+
+func TestScriptAction(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const midiNamedKey = 3
+	const keyCodeA = 4
+	const keyCodeB = 5
+	const threshold = 30
+
+	src := `
+func hit
+  if velocity > 100
+    tap A 20
+  else
+    press B
+    after stop 20
+  end
+end
+
+func stop
+  release B
+  use other
+end
+`
+	program, err := script.Compile(src, map[string]int{"A": keyCodeA, "B": keyCodeB})
+	assert(t, err == nil, "Failed to compile the script: %+v", err)
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCodeA, keyCodeB)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterNamedSet("script")
+	ke.RegisterScriptAction(evType, channel, midiKey, threshold, program, "hit")
+	ke.RegisterNamedSet("other")
+	ke.RegisterBasicPressAction(evType, channel, midiNamedKey, keyCodeA, threshold, 20*time.Millisecond)
+	ke.SetNamedSet("script")
+
+	// Test that the input is ignored bellow the threshold.
+	sendMidiEvent(evType, channel, midiKey, threshold, conn)
+	assertKeyStates(t, kc[keyCodeA], 0)
+	assert(t, !kc[keyCodeA].state && !kc[keyCodeB].state, "no key should have been pressed")
+
+	// Test that hard hits tap the key.
+	sendMidiEvent(evType, channel, midiKey, 120, conn)
+	assertKeyStates(t, kc[keyCodeA], 40*time.Millisecond, true, false)
+
+	// Test that soft hits press the key, releasing it and switching sets later on.
+	sendMidiEvent(evType, channel, midiKey, 60, conn)
+	assertKeyStates(t, kc[keyCodeB], 40*time.Millisecond, true, false)
+	time.Sleep(time.Millisecond)
+
+	sendMidiEvent(evType, channel, midiNamedKey, 60, conn)
+	assertKeyStates(t, kc[keyCodeA], 40*time.Millisecond, true, false)
+}
+
+func TestScriptActionStop(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const midiSwap = 3
+	const keyCode = 4
+	const threshold = 30
+
+	src := `
+func hit
+  press A
+  after repress 20
+end
+
+func repress
+  release A
+  press A
+end
+`
+	program, err := script.Compile(src, map[string]int{"A": keyCode})
+	assert(t, err == nil, "Failed to compile the script: %+v", err)
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterMapSwap(evType, channel, midiSwap, threshold, []string{"script", "other"})
+	ke.RegisterNamedSet("script")
+	ke.RegisterScriptAction(evType, channel, midiKey, threshold, program, "hit")
+	ke.RegisterNamedSet("other")
+	ke.SetNamedSet("script")
+
+	sendMidiEvent(evType, channel, midiKey, 60, conn)
+	assertKeyStates(t, kc[keyCode], 10*time.Millisecond, true)
+
+	// Test that leaving the set releases the key and cancels the queued function.
+	sendMidiEvent(evType, channel, midiSwap, 60, conn)
+	assertKeyStates(t, kc[keyCode], 10*time.Millisecond, false)
+	assertKeyStops(t, kc[keyCode], 40*time.Millisecond)
+}
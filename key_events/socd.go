@@ -0,0 +1,83 @@
+package key_events
+
+// How a SOCD (i.e., Simultaneous Opposing Cardinal Directions) group
+// resolves multiple of its keys being pressed at once.
+type SOCDMode int
+
+const (
+	// The most recently pressed key is the only one kept pressed.
+	SOCDLastWins SOCDMode = iota
+	// The first pressed key is kept pressed until it's released.
+	SOCDFirstWins
+	// None of the keys are pressed while more than one is held.
+	SOCDNeutral
+)
+
+// Maps the name of each SOCDMode, as used in the config file, to its value.
+var socdModeNames = map[string]SOCDMode{
+	"LAST":    SOCDLastWins,
+	"FIRST":   SOCDFirstWins,
+	"NEUTRAL": SOCDNeutral,
+}
+
+// A group of opposing keys, of which at most one may be pressed at a time.
+type socdGroup struct {
+	// How the group resolves multiple of its keys being pressed at once.
+	mode SOCDMode
+	// The keys in the group.
+	keyCodes []int
+	// The keys in the group that are currently held by some action,
+	// in the order that they were pressed.
+	held []int
+}
+
+// press registers that keyCode started being held.
+func (g *socdGroup) press(keyCode int) {
+	g.release(keyCode)
+	g.held = append(g.held, keyCode)
+}
+
+// release registers that keyCode stopped being held.
+func (g *socdGroup) release(keyCode int) {
+	for i, held := range g.held {
+		if held == keyCode {
+			g.held = append(g.held[:i], g.held[i+1:]...)
+			return
+		}
+	}
+}
+
+// remove removes keyCode from the group.
+func (g *socdGroup) remove(keyCode int) {
+	g.release(keyCode)
+	for i, key := range g.keyCodes {
+		if key == keyCode {
+			g.keyCodes = append(g.keyCodes[:i], g.keyCodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// active returns the key in the group that should actually be pressed,
+// based on the keys currently held, and whether there's any such key.
+func (g *socdGroup) active() (int, bool) {
+	if len(g.held) == 0 {
+		return 0, false
+	}
+
+	switch g.mode {
+	case SOCDFirstWins:
+		return g.held[0], true
+	case SOCDNeutral:
+		if len(g.held) > 1 {
+			return 0, false
+		}
+		return g.held[0], true
+	default:
+		return g.held[len(g.held)-1], true
+	}
+}
+
+func (kbEv *keyEvents) RegisterSOCDGroup(mode SOCDMode, keyCodes ...int) {
+	kbEv.keys.AddSOCDGroup(mode, keyCodes...)
+}
@@ -0,0 +1,85 @@
+package key_events
+
+import (
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func (kbEv *keyEvents) RegisterTurboAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	keyCode int,
+	threshold uint8,
+	minPeriod,
+	maxPeriod time.Duration,
+) {
+	event := generateNoteEvent(evType, channel, key)
+
+	kbEv.removeAction(event)
+
+	// Create a new key handler.
+	keyAction := kbEv.newKeyAction(keyCode, nil)
+
+	// Whether the key is currently being repeated.
+	var running bool
+	// The time between each key press.
+	var period time.Duration
+
+	// Alternate between pressing and releasing the key,
+	// keeping it pressed for half of the period.
+	var timer *actionTimer
+	step := func() {
+		if !running {
+			return
+		}
+
+		if keyAction.IsPressed() {
+			keyAction.Release()
+			timer.Reset(period - period/2)
+		} else {
+			keyAction.Press()
+			timer.Reset(period / 2)
+		}
+	}
+	timer = newActionTimer(kbEv.timedAction, step)
+	// Stop the timer's goroutine once the mappings are replaced (or closed).
+	kbEv.closeActions = append(kbEv.closeActions, func() { timer.Close() })
+
+	// Stop repeating the key, making sure that it's released.
+	stop := func() {
+		running = false
+		timer.Stop()
+		if keyAction.IsPressed() {
+			keyAction.Release()
+		}
+	}
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		if running {
+			stop()
+		} else {
+			// Calculate the period based on the key velocity,
+			// so harder hits repeat the key faster.
+			velocity := time.Duration(ev.Velocity)
+			if velocity > midi.MaxVelocity {
+				velocity = midi.MaxVelocity
+			}
+			period = maxPeriod - (maxPeriod-minPeriod)*velocity/midi.MaxVelocity
+
+			running = true
+			step()
+		}
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	keyboard := keyIntToName[keyCode]
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, keyboard) }
+	kbEv.registerStoppableAction(event, action, register, stop)
+}
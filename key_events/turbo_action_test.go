@@ -0,0 +1,152 @@
+package key_events
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// assertKeyStates checks that the key goes through every state in want,
+// in order, each within timeout of the previous one.
+func assertKeyStates(t *testing.T, key *mockKeyCode, timeout time.Duration, want ...bool) {
+	for i, state := range want {
+		select {
+		case got := <-key.newState:
+			assert(t, got == state, "invalid key state %d - want: %v, got: %v", i, state, got)
+		case <-time.After(timeout):
+			t.Fatalf("key state %d wasn't detected in time", i)
+		}
+	}
+}
+
+// assertKeyStops checks that the key stops changing states within timeout,
+// ending released.
+func assertKeyStops(t *testing.T, key *mockKeyCode, timeout time.Duration) {
+	for {
+		select {
+		case <-key.newState:
+		case <-time.After(timeout):
+			assert(t, !key.state, "key wasn't released")
+			return
+		}
+	}
+}
+
+func TestTurboPress(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const keyCode = 3
+	const period = 40 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterTurboAction(
+		evType,
+		channel,
+		midiKey,
+		keyCode,
+		threshold,
+		period,
+		period,
+	)
+
+	// Test that the key is repeatedly pressed after the first event.
+	start := time.Now()
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyCode], period, true, false, true, false, true)
+	elapsed := time.Now().Sub(start)
+	assert(t, elapsed >= 2*period, "key was repeated too quickly: %s", elapsed)
+
+	// Test that the next event stops repeating the key.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStops(t, kc[keyCode], 2*period)
+}
+
+func TestTurboStopsOnSetSwap(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const midiSwapSet = 3
+	const keyCode = 4
+	const period = 40 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterMapSwap(
+		evType,
+		channel,
+		midiSwapSet,
+		threshold,
+		[]string{"SET_A", "SET_B"},
+	)
+
+	ke.RegisterNamedSet("SET_A")
+
+	ke.RegisterTurboAction(
+		evType,
+		channel,
+		midiKey,
+		keyCode,
+		threshold,
+		period,
+		period,
+	)
+
+	ke.RegisterNamedSet("SET_B")
+
+	ke.SetNamedSet("SET_A")
+
+	// Start repeating the key and swap the set while it's pressed.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	assertKeyStates(t, kc[keyCode], period, true, false, true)
+	sendMidiEvent(evType, channel, midiSwapSet, 100, conn)
+	assertKeyStops(t, kc[keyCode], 2*period)
+}
+
+func TestTurboClosesTimer(t *testing.T) {
+	kc := NewMockKeyController()
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	kbEv := newKeyEvents(kc, nil, false, el)
+
+	// Test that replacing the mappings stops the goroutine of every turbo's timer.
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		kbEv.RegisterTurboAction(midi.EventNoteOn, 1, 2, 3, 30, time.Second, time.Second)
+		kbEv.closeMappings()
+		kbEv.mappingTable = newMappingTable(kc)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	after := runtime.NumGoroutine()
+	assert(t, after <= before, "leaked %d goroutines", after-before)
+}
@@ -0,0 +1,220 @@
+package key_events
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// How an action changes a variable.
+type VariableOp int
+
+const (
+	// Sets the variable to the action's value.
+	VariableSet VariableOp = iota
+	// Increments the variable by the action's value.
+	VariableInc
+	// Decrements the variable by the action's value.
+	VariableDec
+)
+
+// An integer variable, bounded to [min, max], which actions may change or read.
+type variable struct {
+	// The variable's current value.
+	value int
+	// The variable's lowest value.
+	min int
+	// The variable's highest value.
+	max int
+	// Functions called whenever the value changes.
+	onChange []func()
+}
+
+// newVariable creates a new variable bounded to [min, max], starting at min.
+func newVariable(min, max int) *variable {
+	return &variable{
+		value: min,
+		min:   min,
+		max:   max,
+	}
+}
+
+// Set changes the variable to value, clamped to the variable's bounds.
+func (v *variable) Set(value int) {
+	if value < v.min {
+		value = v.min
+	} else if value > v.max {
+		value = v.max
+	}
+
+	if value != v.value {
+		v.value = value
+		for _, fn := range v.onChange {
+			fn()
+		}
+	}
+}
+
+// Add adds delta to the variable.
+// If the result is out of the variable's bounds,
+// it either wraps around to the other end or gets clamped.
+func (v *variable) Add(delta int, wrap bool) {
+	value := v.value + delta
+	if wrap {
+		size := v.max - v.min + 1
+		value = v.min + ((value-v.min)%size+size)%size
+	}
+
+	v.Set(value)
+}
+
+// Reset moves the variable back to its lowest value.
+func (v *variable) Reset() {
+	v.Set(v.min)
+}
+
+// Index returns the variable's position within its bounds (i.e., 0 for min).
+func (v *variable) Index() int {
+	return v.value - v.min
+}
+
+// getVariable returns the named variable,
+// creating it if it hasn't been registered yet.
+func (kbEv *keyEvents) getVariable(name string) *variable {
+	v, ok := kbEv.variables[name]
+	if !ok {
+		v = newVariable(0, math.MaxInt32)
+		kbEv.variables[name] = v
+	}
+
+	return v
+}
+
+func (kbEv *keyEvents) RegisterVariable(name string, min, max int) {
+	v := kbEv.getVariable(name)
+	v.min = min
+	v.max = max
+	v.Reset()
+}
+
+func (kbEv *keyEvents) Variable(name string) (int, bool) {
+	v, ok := kbEv.variables[name]
+	if !ok {
+		return 0, false
+	}
+
+	return v.value, true
+}
+
+func (kbEv *keyEvents) RegisterVariableAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	name string,
+	op VariableOp,
+	value int,
+	wrap bool,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	v := kbEv.getVariable(name)
+
+	var label string
+	switch op {
+	case VariableSet:
+		label = name + "=" + strconv.Itoa(value)
+	case VariableInc:
+		label = name + "+" + strconv.Itoa(value)
+	case VariableDec:
+		label = name + "-" + strconv.Itoa(value)
+	}
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		switch op {
+		case VariableSet:
+			v.Set(value)
+		case VariableInc:
+			v.Add(value, wrap)
+		case VariableDec:
+			v.Add(-value, wrap)
+		}
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, label) }
+	kbEv.registerAction(event, action, register)
+}
+
+func (kbEv *keyEvents) RegisterVariableKeyAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	name string,
+	keyCodes [][]int,
+	threshold uint8,
+	releaseTime time.Duration,
+) {
+	event := generateNoteEvent(evType, channel, key)
+	kbEv.removeAction(event)
+
+	v := kbEv.getVariable(name)
+
+	// Create a new key handler for each of the variable's values,
+	// as well as the name of their keys.
+	var actions []*keyAction
+	var keyNames []string
+	for _, keys := range keyCodes {
+		actions = append(actions, kbEv.newKeyActionMulti(keys, nil))
+
+		var names []string
+		for _, keyCode := range keys {
+			names = append(names, keyIntToName[keyCode])
+		}
+		keyNames = append(keyNames, strings.Join(names, ","))
+	}
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		// Values without an associated key are simply ignored.
+		idx := v.Index()
+		if idx >= len(actions) {
+			return
+		}
+
+		actions[idx].Press()
+		actions[idx].QueueTimedAction(releaseTime)
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	// Update the key logged for the action whenever the variable changes,
+	// unless its named set is inactive (and thus another action may be logged for the event).
+	register := func() {
+		var keyboard string
+		if idx := v.Index(); idx < len(keyNames) {
+			keyboard = keyNames[idx]
+		}
+		kbEv.el.SendRegisterEvent(channel, key, keyboard)
+	}
+	set := kbEv.curSet
+	v.onChange = append(v.onChange, func() {
+		if set == "" || kbEv.isSetActive(set) {
+			register()
+		}
+	})
+
+	kbEv.registerAction(event, action, register)
+}
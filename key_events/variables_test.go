@@ -0,0 +1,151 @@
+package key_events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+func TestVariableActions(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiPress = 2
+	const midiInc = 3
+	const midiDec = 4
+	const midiSet = 5
+	const keyCodeA = 6
+	const keyCodeB = 7
+	const keyCodeC = 8
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCodeA, keyCodeB, keyCodeC)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	ke.RegisterVariable("SLOT", 1, 3)
+	ke.RegisterVariableAction(evType, channel, midiInc, threshold, "SLOT", VariableInc, 1, true)
+	ke.RegisterVariableAction(evType, channel, midiDec, threshold, "SLOT", VariableDec, 1, false)
+	ke.RegisterVariableAction(evType, channel, midiSet, threshold, "SLOT", VariableSet, 3, false)
+	ke.RegisterVariableKeyAction(
+		evType,
+		channel,
+		midiPress,
+		"SLOT",
+		[][]int{{keyCodeA}, {keyCodeB}, {keyCodeC}},
+		threshold,
+		releaseTime,
+	)
+
+	// assertSlot sends the MIDI event that changes the variable,
+	// and checks that the selected key is pressed.
+	assertSlot := func(midiKey uint8, keyCode int, value int) {
+		sendMidiEvent(evType, channel, midiKey, 100, conn)
+		time.Sleep(time.Millisecond)
+		assertKeyEvent(t, kc, keyCode, evType, channel, midiPress, 100, conn, releaseTime, 10*time.Millisecond)
+
+		got, ok := ke.Variable("SLOT")
+		assert(t, ok && got == value, "invalid variable - want: %d, got: %d", value, got)
+	}
+
+	// Test that the variable starts at its lowest value.
+	assertKeyEvent(t, kc, keyCodeA, evType, channel, midiPress, 100, conn, releaseTime, 10*time.Millisecond)
+
+	// Test that incrementing the variable wraps around.
+	assertSlot(midiInc, keyCodeB, 2)
+	assertSlot(midiInc, keyCodeC, 3)
+	assertSlot(midiInc, keyCodeA, 1)
+
+	// Test that decrementing the variable (without wrapping) is clamped.
+	assertSlot(midiDec, keyCodeA, 1)
+
+	// Test that the variable may be set directly.
+	assertSlot(midiSet, keyCodeC, 3)
+	assertSlot(midiDec, keyCodeB, 2)
+}
+
+// An event logger that also reports every register event to registered.
+type registerLogger struct {
+	event_logger.EventLogger
+	registered chan string
+}
+
+func (el registerLogger) SendRegisterEvent(channel, key uint8, keyboard string) {
+	el.registered <- fmt.Sprintf("ch=%d ev=%d key=%s", channel, key, keyboard)
+}
+
+func TestVariableKeyActionInactiveSet(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiPress = 2
+	const midiInc = 3
+	const midiSwap = 4
+	keyA := keyNameToInt["A"]
+	keyB := keyNameToInt["B"]
+	keyC := keyNameToInt["C"]
+	const releaseTime = 20 * time.Millisecond
+	const threshold = 30
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyA, keyB, keyC)
+	defer kc.Close()
+
+	el := registerLogger{event_logger.New(nil), make(chan string, 64)}
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// SET_A shows the variable's key on the pad, while SET_B maps the pad to 'C'.
+	ke.RegisterVariable("SLOT", 1, 2)
+	ke.RegisterVariableAction(evType, channel, midiInc, threshold, "SLOT", VariableInc, 1, true)
+	ke.RegisterMapSwap(evType, channel, midiSwap, threshold, []string{"SET_B", "SET_A"})
+
+	ke.RegisterNamedSet("SET_A")
+	ke.RegisterVariableKeyAction(evType, channel, midiPress, "SLOT", [][]int{{keyA}, {keyB}}, threshold, releaseTime)
+
+	ke.RegisterNamedSet("SET_B")
+	ke.RegisterBasicPressAction(evType, channel, midiPress, keyC, threshold, releaseTime)
+
+	ke.SetNamedSet("SET_B")
+
+	// registered lists the register events sent within a short while.
+	registered := func() []string {
+		var events []string
+		for {
+			select {
+			case ev := <-el.registered:
+				events = append(events, ev)
+			case <-time.After(20 * time.Millisecond):
+				return events
+			}
+		}
+	}
+	registered()
+
+	// Test that changing the variable doesn't replace SET_B's key for the pad.
+	sendMidiEvent(evType, channel, midiInc, 100, conn)
+	for _, ev := range registered() {
+		assert(t, ev != "ch=1 ev=2 key=B", "the inactive set's key was registered: %s", ev)
+	}
+
+	// Test that the variable's key is registered once its set is active.
+	sendMidiEvent(evType, channel, midiSwap, 100, conn)
+	registered()
+	sendMidiEvent(evType, channel, midiInc, 100, conn)
+	events := registered()
+	assert(t, len(events) == 1 && events[0] == "ch=1 ev=2 key=A", "expected the variable's key to be registered, got: %+v", events)
+}
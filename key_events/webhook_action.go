@@ -0,0 +1,140 @@
+package key_events
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// How many requests may be queued for a single webhook.
+const webhookQueueSize = 8
+
+// The values available to the templates of a webhook.
+type webhookData struct {
+	// The MIDI event's channel.
+	Channel uint8
+	// The MIDI event's key.
+	Key uint8
+	// The MIDI event's velocity.
+	Velocity uint8
+	// The timestamp when the MIDI event was generated, in milliseconds.
+	Timestamp int32
+}
+
+// A webhook sent in response to a MIDI event.
+type webhook struct {
+	// The HTTP client used to send the requests.
+	client *http.Client
+	// The request's method.
+	method string
+	// The template used to generate the request's URL.
+	url *template.Template
+	// The template used to generate the request's body.
+	body *template.Template
+	// Requests waiting to be sent.
+	queue chan midi.MidiEvent
+}
+
+// send sends every queued request, one at a time, until the queue gets closed.
+func (wh *webhook) send() {
+	var url, body bytes.Buffer
+
+	for ev := range wh.queue {
+		data := webhookData{
+			Channel:   ev.Channel,
+			Key:       ev.Key,
+			Velocity:  ev.Velocity,
+			Timestamp: ev.Timestamp,
+		}
+
+		url.Reset()
+		body.Reset()
+		if err := wh.url.Execute(&url, &data); err != nil {
+			log.Printf("webhook: failed to generate the URL: %+v", err)
+			continue
+		} else if err := wh.body.Execute(&body, &data); err != nil {
+			log.Printf("webhook: failed to generate the body: %+v", err)
+			continue
+		}
+
+		req, err := http.NewRequest(wh.method, url.String(), &body)
+		if err != nil {
+			log.Printf("webhook: failed to create the request: %+v", err)
+			continue
+		}
+		if body.Len() > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := wh.client.Do(req)
+		if err != nil {
+			log.Printf("webhook: failed to send the request: %+v", err)
+			continue
+		} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Printf("webhook: request failed with code '%s'", resp.Status)
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+func (kbEv *keyEvents) RegisterWebhookAction(
+	evType midi.MidiEventType,
+	channel,
+	key uint8,
+	threshold uint8,
+	timeout time.Duration,
+	method,
+	url,
+	body string,
+) error {
+	urlTemplate, err := template.New("url").Parse(url)
+	if err != nil {
+		return err
+	}
+	bodyTemplate, err := template.New("body").Parse(body)
+	if err != nil {
+		return err
+	}
+
+	event := generateNoteEvent(evType, channel, key)
+
+	kbEv.removeAction(event)
+
+	wh := &webhook{
+		client: &http.Client{Timeout: timeout},
+		method: method,
+		url:    urlTemplate,
+		body:   bodyTemplate,
+		queue:  make(chan midi.MidiEvent, webhookQueueSize),
+	}
+	go wh.send()
+	// Stop sending requests once the mappings are replaced (or closed).
+	kbEv.closeActions = append(kbEv.closeActions, func() { close(wh.queue) })
+
+	// Register the onPress function.
+	action := func(ev midi.MidiEvent) {
+		if ev.Type != midi.EventNoteOn || ev.Velocity <= threshold {
+			return
+		}
+
+		// Queue the request without ever blocking the event handler.
+		select {
+		case wh.queue <- ev:
+		default:
+			log.Printf("webhook: dropping request to '%s', too many queued requests", url)
+		}
+		kbEv.el.SendMIDIEvent(channel, key)
+	}
+
+	register := func() { kbEv.el.SendRegisterEvent(channel, key, "WEBHOOK") }
+	kbEv.registerAction(event, action, register)
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package key_events
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/event_logger"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// A request received by the test server.
+type webhookRequest struct {
+	// The request's method.
+	method string
+	// The request's path.
+	path string
+	// The request's body.
+	body string
+}
+
+func TestWebhookAction(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const threshold = 30
+
+	requests := make(chan webhookRequest, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{
+			method: r.Method,
+			path:   r.URL.Path,
+			body:   string(body),
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController()
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	// Test that invalid templates are rejected.
+	err = ke.RegisterWebhookAction(evType, channel, midiKey, threshold, time.Second, "PUT", server.URL+"/{{.Key", "")
+	assert(t, err != nil, "a webhook with an invalid template should have failed")
+
+	err = ke.RegisterWebhookAction(
+		evType,
+		channel,
+		midiKey,
+		threshold,
+		time.Second,
+		"PUT",
+		server.URL+"/hit/{{.Key}}",
+		`{"channel":{{.Channel}},"velocity":{{.Velocity}}}`,
+	)
+	assert(t, err == nil, "Failed to register the webhook: %+v", err)
+
+	// Test that events bellow the threshold are ignored.
+	sendMidiEvent(evType, channel, midiKey, threshold, conn)
+	select {
+	case req := <-requests:
+		t.Fatalf("request sent by an event bellow the threshold: %+v", req)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Test that the request is generated from the event.
+	sendMidiEvent(evType, channel, midiKey, 100, conn)
+	select {
+	case req := <-requests:
+		want := webhookRequest{
+			method: "PUT",
+			path:   "/hit/2",
+			body:   `{"channel":1,"velocity":100}`,
+		}
+		assert(t, req == want, "invalid request - want: %+v, got: %+v", want, req)
+	case <-time.After(time.Second):
+		t.Fatalf("request wasn't sent in time")
+	}
+}
+
+func TestWebhookActionDoesntBlock(t *testing.T) {
+	const evType = midi.EventNoteOn
+	const channel = 1
+	const midiKey = 2
+	const keyMidiKey = 3
+	const keyCode = 4
+	const threshold = 30
+
+	// The server never answers until the test is done.
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	conn := make(chan midi.MidiEvent, 1)
+	defer close(conn)
+	kc := NewMockKeyController(keyCode)
+	defer kc.Close()
+
+	el := event_logger.New(nil)
+	defer el.Close()
+
+	ke, err := NewKeyEvents(kc, conn, false, el)
+	assert(t, err == nil, "Failed to start the key event generator")
+	defer ke.Close()
+
+	err = ke.RegisterWebhookAction(
+		evType,
+		channel,
+		midiKey,
+		threshold,
+		time.Minute,
+		"POST",
+		server.URL,
+		"",
+	)
+	assert(t, err == nil, "Failed to register the webhook: %+v", err)
+	ke.RegisterBasicPressAction(
+		evType,
+		channel,
+		keyMidiKey,
+		keyCode,
+		threshold,
+		10*time.Millisecond,
+	)
+
+	// Fill the webhook's queue, and then some.
+	for i := 0; i < webhookQueueSize*2; i++ {
+		sendMidiEvent(evType, channel, midiKey, 100, conn)
+	}
+
+	// Test that other events are still handled.
+	assertKeyEvent(
+		t,
+		kc,
+		keyCode,
+		evType,
+		channel,
+		keyMidiKey,
+		100,
+		conn,
+		10*time.Millisecond,
+		time.Millisecond,
+	)
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/SirGFM/midi-go-key/event_logger"
 	"github.com/SirGFM/midi-go-key/key_events"
@@ -19,12 +21,22 @@ const defaulEventQueueSize = 64
 func main() {
 	defer midi.Cleanup()
 
+	// Check the config file and exit, without opening any device.
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(os.Args[2:])
+		return
+	}
+
 	eventQueueSize := flag.Int("queueSize", defaulEventQueueSize, "how many events may be queued")
 	port := flag.Int("port", 0, "the device's port")
 	list := flag.Bool("list", false, "whether the application should list the devices and exit")
-	path := flag.String("config", "./config.txt", "the path to the configuration file")
+	path := flag.String("config", "./config.txt", "the path to the configuration file (either a text file, or a JSON file ending in .json)")
+	kit := flag.String("kit", "", "(optional) the path to the kit profile, a configuration file read before the configuration file (e.g., naming the kit's pads with 'define')")
 	endpoint := flag.String("endpoint", "http://localhost:8080/ram_store/drums", "(optional) the overlay endpoint")
 	logUnhandled := flag.Bool("log-unhandled", false, "whether unhandled events should be logged")
+	middleC := flag.Int("middle-c", 4, "(optional) the octave of middle C (i.e., note 60) in note names, usually either 4 (i.e., 'C4') or 3 (i.e., 'C3')")
+	maxHold := flag.Duration("max-hold", 0, "(optional) for how long keys may be held before being automatically released (e.g., 30s)")
+	reloadInterval := flag.Duration("reload-interval", time.Second, "(optional) how often the config file is checked for changes, reloading it once modified (0 disables it, but SIGHUP still reloads it)")
 	flag.Parse()
 
 	// List the devices and exit.
@@ -57,6 +69,17 @@ func main() {
 		logUnhandled = new(bool)
 		*logUnhandled = false
 	}
+	if maxHold == nil {
+		maxHold = new(time.Duration)
+	}
+	if reloadInterval == nil {
+		reloadInterval = new(time.Duration)
+		*reloadInterval = time.Second
+	}
+
+	if middleC != nil {
+		midi.SetMiddleCOctave(*middleC)
+	}
 
 	el := event_logger.New(endpoint)
 	defer el.Close()
@@ -74,11 +97,18 @@ func main() {
 	}
 	defer kb.Close()
 
+	kb.SetMaxHold(*maxHold)
+	if kit != nil {
+		kb.SetKitProfile(*kit)
+	}
+
 	if len(*path) > 0 {
 		err = kb.ReadConfig(*path)
 		if err != nil {
 			panic(fmt.Sprintf("%+v", err))
 		}
+
+		go watchConfig(kb, *path, *reloadInterval)
 	}
 
 	midiDev, err := midi.NewMidi(*port, conn)
@@ -88,9 +118,10 @@ func main() {
 	defer midiDev.Close()
 
 	// Register a signal handler, so the application may sleep until it's done.
+	// Every pressed key is released as the deferred functions get called.
 	log.Println("listening to device...")
 	intHndlr := make(chan os.Signal, 1)
-	signal.Notify(intHndlr, os.Interrupt)
+	signal.Notify(intHndlr, os.Interrupt, syscall.SIGTERM)
 	<-intHndlr
 	log.Printf("exiting...")
 }
@@ -34,6 +34,8 @@ const (
 	EventNoteOn
 	// Note Off event (0x8x xx xx ...)
 	EventNoteOff
+	// Control Change event (0xBx xx xx ...)
+	EventControlChange
 )
 
 func (evType MidiEventType) String() string {
@@ -44,6 +46,8 @@ func (evType MidiEventType) String() string {
 		return "EventNoteOn"
 	case EventNoteOff:
 		return "EventNoteOff"
+	case EventControlChange:
+		return "EventControlChange"
 	default:
 		return "Invalid MidiEventType"
 	}
@@ -58,6 +62,8 @@ func (evType MidiEventType) ToUint8() uint8 {
 		return 0x90
 	case EventNoteOff:
 		return 0x80
+	case EventControlChange:
+		return 0xb0
 	default:
 		return 0x00
 	}
@@ -73,20 +79,41 @@ type MidiEvent struct {
 	Type MidiEventType
 	// The message's channel.
 	Channel uint8
-	// The message's key.
+	// The message's key (or controller, for Control Change events).
 	Key uint8
-	// The message's velocity.
+	// The message's velocity (or value, for Control Change events).
 	Velocity uint8
 }
 
+// KeyName names the event's key as a note (e.g., "D2") and,
+// on the percussion channel, also as a General MIDI percussion name (e.g., "D2 acoustic-snare").
+// Control Change events aren't named, since their key is a controller.
+func (ev MidiEvent) KeyName() string {
+	if ev.Type != EventNoteOn && ev.Type != EventNoteOff {
+		return ""
+	}
+
+	name := NoteName(ev.Key)
+	if drum, ok := DrumName(ev.Key); ok && ev.Channel == DrumChannel {
+		name += " " + drum
+	}
+
+	return name
+}
+
 // Convert the MIDI event to a string.
 func (ev MidiEvent) String() string {
+	key := fmt.Sprintf("%x", ev.Key)
+	if name := ev.KeyName(); name != "" {
+		key += " (" + name + ")"
+	}
+
 	return fmt.Sprintf(
-		"% 16d: %x - chan: %x - key: %x - vel: %d - type: %s",
+		"% 16d: %x - chan: %x - key: %s - vel: %d - type: %s",
 		ev.Timestamp,
 		ev.Source,
 		ev.Channel,
-		ev.Key,
+		key,
 		ev.Velocity,
 		ev.Type,
 	)
@@ -135,6 +162,8 @@ func (m *midiDev) recv(msg midi.Message, timestampMs int32) {
 		ev.Type = EventNoteOn
 	case msg.GetNoteOff(&ev.Channel, &ev.Key, &ev.Velocity):
 		ev.Type = EventNoteOff
+	case msg.GetControlChange(&ev.Channel, &ev.Key, &ev.Velocity):
+		ev.Type = EventControlChange
 	default:
 		ev.Type = EventUnknown
 	}
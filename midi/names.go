@@ -0,0 +1,144 @@
+package midi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The octave of middle C (i.e., note 60) in note names.
+var middleCOctave = 4
+
+// SetMiddleCOctave configures the octave of middle C (i.e., note 60) in note names.
+// It defaults to 4, as in scientific pitch notation (i.e., note 60 is "C4"),
+// but some manufacturers (e.g., Yamaha) use 3 instead.
+// This should be called before any note name is parsed or generated.
+func SetMiddleCOctave(octave int) {
+	middleCOctave = octave
+}
+
+// The name of each note in an octave, starting at C.
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// The semitone of each natural note, in relation to C.
+var noteSemitones = map[byte]int{
+	'C': 0,
+	'D': 2,
+	'E': 4,
+	'F': 5,
+	'G': 7,
+	'A': 9,
+	'B': 11,
+}
+
+// The General MIDI percussion names, by their note.
+var drumNames = map[uint8]string{
+	35: "acoustic-bass-drum",
+	36: "bass-drum-1",
+	37: "side-stick",
+	38: "acoustic-snare",
+	39: "hand-clap",
+	40: "electric-snare",
+	41: "low-floor-tom",
+	42: "closed-hihat",
+	43: "high-floor-tom",
+	44: "pedal-hihat",
+	45: "low-tom",
+	46: "open-hihat",
+	47: "low-mid-tom",
+	48: "hi-mid-tom",
+	49: "crash-cymbal-1",
+	50: "high-tom",
+	51: "ride-cymbal-1",
+	52: "chinese-cymbal",
+	53: "ride-bell",
+	54: "tambourine",
+	55: "splash-cymbal",
+	56: "cowbell",
+	57: "crash-cymbal-2",
+	58: "vibraslap",
+	59: "ride-cymbal-2",
+	60: "hi-bongo",
+	61: "low-bongo",
+	62: "mute-hi-conga",
+	63: "open-hi-conga",
+	64: "low-conga",
+	65: "high-timbale",
+	66: "low-timbale",
+	67: "high-agogo",
+	68: "low-agogo",
+	69: "cabasa",
+	70: "maracas",
+	71: "short-whistle",
+	72: "long-whistle",
+	73: "short-guiro",
+	74: "long-guiro",
+	75: "claves",
+	76: "hi-wood-block",
+	77: "low-wood-block",
+	78: "mute-cuica",
+	79: "open-cuica",
+	80: "mute-triangle",
+	81: "open-triangle",
+}
+
+// The General MIDI percussion notes, by their names.
+var drumNotes = func() map[string]uint8 {
+	notes := make(map[string]uint8, len(drumNames))
+	for note, name := range drumNames {
+		notes[name] = note
+	}
+
+	return notes
+}()
+
+// The channel used by General MIDI percussion (i.e., channel 10, counting from 1).
+const DrumChannel = 9
+
+// NoteName names the note (e.g., 61 is "C#4", considering that middle C is in octave 4).
+func NoteName(note uint8) string {
+	octave := int(note)/12 - 5 + middleCOctave
+	return noteNames[note%12] + strconv.Itoa(octave)
+}
+
+// DrumName returns the General MIDI percussion name of the note (e.g., 38 is "acoustic-snare"), if any.
+func DrumName(note uint8) (string, bool) {
+	name, ok := drumNames[note]
+	return name, ok
+}
+
+// ParseNote converts either a note name (e.g., "C#2" or "Db2")
+// or a General MIDI percussion name (e.g., "acoustic-snare") into its note.
+// Names are case insensitive, except for flats, which must be written as 'b'.
+func ParseNote(name string) (uint8, bool) {
+	if note, ok := drumNotes[strings.ToLower(name)]; ok {
+		return note, true
+	} else if len(name) < 2 {
+		return 0, false
+	}
+
+	semitone, ok := noteSemitones[strings.ToUpper(name[:1])[0]]
+	if !ok {
+		return 0, false
+	}
+	name = name[1:]
+
+	if name[0] == '#' {
+		semitone++
+		name = name[1:]
+	} else if name[0] == 'b' && len(name) > 1 {
+		semitone--
+		name = name[1:]
+	}
+
+	octave, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, false
+	}
+
+	note := (octave+5-middleCOctave)*12 + semitone
+	if note < 0 || note > 127 {
+		return 0, false
+	}
+
+	return uint8(note), true
+}
@@ -0,0 +1,63 @@
+package midi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNoteNames(t *testing.T) {
+	defer SetMiddleCOctave(4)
+
+	for _, tc := range []struct {
+		middleC int
+		name    string
+		note    uint8
+		ok      bool
+	}{
+		{4, "C4", 60, true},
+		{4, "C#2", 37, true},
+		{4, "Db2", 37, true},
+		{4, "c#2", 37, true},
+		{4, "C-1", 0, true},
+		{4, "G9", 127, true},
+		{4, "G#9", 0, false},
+		{4, "H2", 0, false},
+		{4, "C", 0, false},
+		{4, "acoustic-snare", 38, true},
+		{4, "Closed-HiHat", 42, true},
+		{3, "C3", 60, true},
+		{3, "D1", 38, true},
+	} {
+		SetMiddleCOctave(tc.middleC)
+
+		note, ok := ParseNote(tc.name)
+		if ok != tc.ok || note != tc.note {
+			t.Fatalf("'%s' (middle C in octave %d) should be %d (%v), got: %d (%v)", tc.name, tc.middleC, tc.note, tc.ok, note, ok)
+		}
+	}
+
+	SetMiddleCOctave(4)
+	for note, name := range map[uint8]string{0: "C-1", 37: "C#2", 60: "C4", 127: "G9"} {
+		if got := NoteName(note); got != name {
+			t.Fatalf("%d should be named '%s', got: '%s'", note, name, got)
+		}
+	}
+	SetMiddleCOctave(3)
+	if got := NoteName(60); got != "C3" {
+		t.Fatalf("60 should be named 'C3' with middle C in octave 3, got: '%s'", got)
+	}
+	SetMiddleCOctave(4)
+
+	ev := MidiEvent{Type: EventNoteOn, Channel: DrumChannel, Key: 38, Velocity: 100}
+	if got := ev.String(); !strings.Contains(got, "key: 26 (D2 acoustic-snare)") {
+		t.Fatalf("the event should name its key, got: '%s'", got)
+	}
+	ev.Channel = 0
+	if got := ev.String(); !strings.Contains(got, "key: 26 (D2)") {
+		t.Fatalf("only the percussion channel should use percussion names, got: '%s'", got)
+	}
+	ev.Type = EventControlChange
+	if got := ev.String(); !strings.Contains(got, "key: 26 -") {
+		t.Fatalf("controllers shouldn't be named, got: '%s'", got)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/key_events"
+)
+
+// watchConfig reloads the config file in path whenever the application receives a SIGHUP
+// or, if interval isn't zero, whenever the file is modified (checking it every interval),
+// until the key events generator gets closed.
+func watchConfig(kb key_events.KeyEvents, path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lastMod := modTime(path)
+	for {
+		select {
+		case <-hup:
+			log.Printf("config: received SIGHUP, reloading '%s'", path)
+		case <-tick:
+			mod := modTime(path)
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			log.Printf("config: '%s' was modified, reloading it", path)
+		}
+
+		if err := kb.ReloadConfig(path); errors.Is(err, key_events.ErrKeyEventsClosed) {
+			return
+		} else if err != nil {
+			log.Printf("config: keeping the previous config: %+v", err)
+		} else {
+			log.Printf("config: reloaded '%s'", path)
+		}
+	}
+}
+
+// modTime returns when the file in path was last modified,
+// or the zero time if it can't be accessed (e.g., while an editor is replacing it).
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
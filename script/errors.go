@@ -0,0 +1,47 @@
+package script
+
+// Represents errors in this package.
+type errCode int
+
+const (
+	// The script has a syntax error
+	ErrSyntax errCode = iota
+	// The script uses an unknown key
+	ErrUnknownKey
+	// The script uses an unknown function
+	ErrUnknownFunction
+	// The script uses an unknown variable
+	ErrUnknownVariable
+	// The script defines the same name more than once
+	ErrRedefined
+	// The script divided by zero
+	ErrDivideByZero
+	// The script called too many nested functions
+	ErrCallDepth
+	// The script executed too many statements in a single call
+	ErrTooManySteps
+)
+
+// Implements the 'error' interface for 'errCode'.
+func (e errCode) Error() string {
+	switch e {
+	case ErrSyntax:
+		return "(script) syntax error"
+	case ErrUnknownKey:
+		return "(script) unknown key"
+	case ErrUnknownFunction:
+		return "(script) unknown function"
+	case ErrUnknownVariable:
+		return `(script) unknown variable, must be declared with "var" or be one of channel, note, velocity, time`
+	case ErrRedefined:
+		return "(script) name defined more than once"
+	case ErrDivideByZero:
+		return "(script) division by zero"
+	case ErrCallDepth:
+		return "(script) too many nested function calls"
+	case ErrTooManySteps:
+		return "(script) too many statements executed in a single call"
+	default:
+		return "(script) unknown error"
+	}
+}
@@ -0,0 +1,346 @@
+package script
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Operators recognized in expressions, longest first,
+// so "<=" isn't read as "<" followed by "=".
+var operators = []string{
+	"||", "&&", "==", "!=", "<=", ">=",
+	"<", ">", "+", "-", "*", "/", "%", "!", "(", ")",
+}
+
+// Binary operators, from the lowest precedence to the highest.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// An expression, which always evaluates to an integer.
+// Booleans are represented as 1 (true) and 0 (false).
+type expr interface {
+	eval(c *call) (int, error)
+}
+
+// An integer literal.
+type numberExpr int
+
+func (e numberExpr) eval(c *call) (int, error) {
+	return int(e), nil
+}
+
+// Reads a script variable or a field of the MIDI event.
+type varExpr string
+
+func (e varExpr) eval(c *call) (int, error) {
+	switch string(e) {
+	case "channel":
+		return int(c.ev.Channel), nil
+	case "note":
+		return int(c.ev.Key), nil
+	case "velocity":
+		return int(c.ev.Velocity), nil
+	case "time":
+		return int(c.ev.Timestamp), nil
+	}
+
+	return c.prog.globals[string(e)], nil
+}
+
+// Applies an unary operator ("-" or "!") to an expression.
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (e unaryExpr) eval(c *call) (int, error) {
+	x, err := e.x.eval(c)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.op == "-" {
+		return -x, nil
+	}
+	return boolToInt(x == 0), nil
+}
+
+// Applies a binary operator to two expressions.
+type binaryExpr struct {
+	op   string
+	x, y expr
+}
+
+func (e binaryExpr) eval(c *call) (int, error) {
+	x, err := e.x.eval(c)
+	if err != nil {
+		return 0, err
+	}
+
+	// Short-circuit logical operators.
+	if e.op == "||" && x != 0 {
+		return 1, nil
+	} else if e.op == "&&" && x == 0 {
+		return 0, nil
+	}
+
+	y, err := e.y.eval(c)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.op {
+	case "||", "&&":
+		return boolToInt(y != 0), nil
+	case "==":
+		return boolToInt(x == y), nil
+	case "!=":
+		return boolToInt(x != y), nil
+	case "<":
+		return boolToInt(x < y), nil
+	case "<=":
+		return boolToInt(x <= y), nil
+	case ">":
+		return boolToInt(x > y), nil
+	case ">=":
+		return boolToInt(x >= y), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, ErrDivideByZero
+		} else if e.op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	}
+
+	return 0, ErrSyntax
+}
+
+// Checks whether a key is being held, by calling "held(KEY)".
+type heldExpr int
+
+func (e heldExpr) eval(c *call) (int, error) {
+	return boolToInt(c.host.IsKeyHeld(int(e))), nil
+}
+
+// Checks whether a named set is active, by calling "active(SET)".
+type activeExpr string
+
+func (e activeExpr) eval(c *call) (int, error) {
+	return boolToInt(c.host.IsSetActive(string(e))), nil
+}
+
+// boolToInt converts a boolean to its integer representation.
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// tokenize breaks an expression into its numbers, names and operators.
+func tokenize(src string) ([]string, error) {
+	var tokens []string
+
+	for src = strings.TrimSpace(src); src != ""; src = strings.TrimSpace(src) {
+		var token string
+		for _, op := range operators {
+			if strings.HasPrefix(src, op) {
+				token = op
+				break
+			}
+		}
+
+		if token == "" {
+			end := strings.IndexFunc(src, func(r rune) bool {
+				return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end == 0 {
+				return nil, ErrSyntax
+			} else if end == -1 {
+				end = len(src)
+			}
+			token = src[:end]
+		}
+
+		tokens = append(tokens, token)
+		src = src[len(token):]
+	}
+
+	return tokens, nil
+}
+
+// An expression being parsed.
+type exprParser struct {
+	// The program that owns the expression.
+	prog *Program
+	// The expression's remaining tokens.
+	tokens []string
+}
+
+// parseExpr parses an expression,
+// checking that every key and variable used by it exists.
+func (p *Program) parseExpr(src string) (expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &exprParser{prog: p, tokens: tokens}
+	e, err := parser.parseBinary(0)
+	if err != nil {
+		return nil, err
+	} else if len(parser.tokens) != 0 {
+		return nil, ErrSyntax
+	}
+
+	return e, nil
+}
+
+// next removes and returns the next token, or "" if there are no tokens left.
+func (p *exprParser) next() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+
+	token := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return token
+}
+
+// peek returns the next token, without removing it.
+func (p *exprParser) peek() string {
+	if len(p.tokens) == 0 {
+		return ""
+	}
+	return p.tokens[0]
+}
+
+// parseBinary parses binary operators with at least the given precedence level.
+func (p *exprParser) parseBinary(level int) (expr, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+
+	x, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+
+		var found bool
+		for _, candidate := range precedence[level] {
+			found = found || op == candidate
+		}
+		if !found {
+			return x, nil
+		}
+		p.next()
+
+		y, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, x: x, y: y}
+	}
+}
+
+// parseUnary parses an expression optionally preceded by "-" or "!".
+func (p *exprParser) parseUnary() (expr, error) {
+	if op := p.peek(); op == "-" || op == "!" {
+		p.next()
+
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, x: x}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a number, a variable, a builtin call or a parenthesized expression.
+func (p *exprParser) parsePrimary() (expr, error) {
+	token := p.next()
+
+	switch {
+	case token == "(":
+		x, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		} else if p.next() != ")" {
+			return nil, ErrSyntax
+		}
+		return x, nil
+	case token == "held" || token == "active":
+		if p.next() != "(" {
+			return nil, ErrSyntax
+		}
+		arg := p.next()
+		if p.next() != ")" {
+			return nil, ErrSyntax
+		}
+
+		if token == "active" {
+			return activeExpr(arg), nil
+		}
+		keyCode, err := p.prog.keyCode(arg)
+		if err != nil {
+			return nil, err
+		}
+		return heldExpr(keyCode), nil
+	case token != "" && token[0] >= '0' && token[0] <= '9':
+		value, err := strconv.ParseInt(token, 0, 32)
+		if err != nil {
+			return nil, ErrSyntax
+		}
+		return numberExpr(value), nil
+	case isName(token):
+		if !isEventField(token) {
+			if _, ok := p.prog.globals[token]; !ok {
+				return nil, ErrUnknownVariable
+			}
+		}
+		return varExpr(token), nil
+	}
+
+	return nil, ErrSyntax
+}
+
+// isName checks whether token may be used as a name (e.g., a variable or a function).
+func isName(token string) bool {
+	if token == "" || token[0] >= '0' && token[0] <= '9' {
+		return false
+	}
+
+	for _, r := range token {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// isEventField checks whether name is one of the MIDI event's fields.
+func isEventField(name string) bool {
+	switch name {
+	case "channel", "note", "velocity", "time":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,428 @@
+package script
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Words that can't be used as names of functions or variables.
+var reserved = map[string]bool{
+	"var":     true,
+	"func":    true,
+	"if":      true,
+	"elif":    true,
+	"else":    true,
+	"end":     true,
+	"press":   true,
+	"release": true,
+	"tap":     true,
+	"after":   true,
+	"call":    true,
+	"use":     true,
+	"return":  true,
+	"held":    true,
+	"active":  true,
+}
+
+// A statement in a function.
+type statement interface {
+	// exec executes the statement, returning whether it returned from the function.
+	exec(c *call) (bool, error)
+	// line returns the line where the statement was defined.
+	line() int
+	// source returns the statement's source code.
+	source() string
+}
+
+// Where a statement was defined.
+type location struct {
+	// The line where the statement was defined.
+	lineNum int
+	// The statement's source code.
+	src string
+}
+
+func (l location) line() int {
+	return l.lineNum
+}
+
+func (l location) source() string {
+	return l.src
+}
+
+// Runs the first block whose condition holds, or the else block if none does.
+type ifStmt struct {
+	location
+	// The conditions of the "if" and of every "elif".
+	conds []expr
+	// The block executed by each condition.
+	blocks [][]statement
+	// The block executed if no condition holds. May be nil.
+	elseBlock []statement
+}
+
+func (s *ifStmt) exec(c *call) (bool, error) {
+	for i, cond := range s.conds {
+		value, err := cond.eval(c)
+		if err != nil {
+			return false, err
+		} else if value != 0 {
+			return c.exec(s.blocks[i])
+		}
+	}
+
+	return c.exec(s.elseBlock)
+}
+
+// Sets a variable.
+type assignStmt struct {
+	location
+	name  string
+	value expr
+}
+
+func (s *assignStmt) exec(c *call) (bool, error) {
+	value, err := s.value.eval(c)
+	if err != nil {
+		return false, err
+	}
+
+	c.prog.globals[s.name] = value
+	return false, nil
+}
+
+// Presses or releases keys.
+type keysStmt struct {
+	location
+	press    bool
+	keyCodes []int
+}
+
+func (s *keysStmt) exec(c *call) (bool, error) {
+	if s.press {
+		c.host.PressKeys(s.keyCodes)
+	} else {
+		c.host.ReleaseKeys(s.keyCodes)
+	}
+	return false, nil
+}
+
+// Presses keys and releases them after a while.
+type tapStmt struct {
+	location
+	keyCodes    []int
+	releaseTime expr
+}
+
+func (s *tapStmt) exec(c *call) (bool, error) {
+	releaseTime, err := c.durationArg(s.releaseTime)
+	if err != nil {
+		return false, err
+	}
+
+	c.host.TapKeys(s.keyCodes, releaseTime)
+	return false, nil
+}
+
+// Calls a function after a while.
+type afterStmt struct {
+	location
+	name  string
+	delay expr
+}
+
+func (s *afterStmt) exec(c *call) (bool, error) {
+	delay, err := c.durationArg(s.delay)
+	if err != nil {
+		return false, err
+	}
+
+	c.after(s.name, delay)
+	return false, nil
+}
+
+// Calls a function.
+type callStmt struct {
+	location
+	name string
+}
+
+func (s *callStmt) exec(c *call) (bool, error) {
+	return false, c.run(s.name)
+}
+
+// Activates a named set.
+type useStmt struct {
+	location
+	name string
+}
+
+func (s *useStmt) exec(c *call) (bool, error) {
+	c.host.UseSet(s.name)
+	return false, nil
+}
+
+// Returns from the current function.
+type returnStmt struct {
+	location
+}
+
+func (s *returnStmt) exec(c *call) (bool, error) {
+	return true, nil
+}
+
+// The state of the script being parsed.
+type parser struct {
+	// The program receiving the parsed functions.
+	prog *Program
+	// Every call to a function, by the line that called it.
+	called map[int]string
+	// The script's lines.
+	lines []string
+	// The index of the next line to be parsed.
+	next int
+}
+
+// parse parses every line in the script.
+func (p *parser) parse(lines []string) error {
+	p.lines = lines
+
+	for p.next < len(p.lines) {
+		lineNum, fields, src := p.nextLine()
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "var":
+			// Variables are declared as "var NAME = VALUE".
+			if len(fields) != 4 || fields[2] != "=" {
+				return lineError(lineNum, src, ErrSyntax)
+			}
+			name := fields[1]
+			if err := p.checkName(name); err != nil {
+				return lineError(lineNum, name, err)
+			}
+			value, err := strconv.ParseInt(fields[3], 0, 32)
+			if err != nil {
+				return lineError(lineNum, fields[3], ErrSyntax)
+			}
+
+			p.prog.globals[name] = int(value)
+			p.prog.initial[name] = int(value)
+		case "func":
+			if len(fields) != 2 {
+				return lineError(lineNum, src, ErrSyntax)
+			}
+			name := fields[1]
+			if err := p.checkName(name); err != nil {
+				return lineError(lineNum, name, err)
+			}
+
+			// Register the function before parsing it, so it may call itself.
+			p.prog.funcs[name] = nil
+			block, end, err := p.parseBlock()
+			if err != nil {
+				return err
+			} else if end != "end" {
+				return lineError(lineNum, src, ErrSyntax)
+			} else if endNum, fields, endSrc := p.nextLine(); len(fields) != 1 {
+				return lineError(endNum, endSrc, ErrSyntax)
+			}
+			p.prog.funcs[name] = block
+		default:
+			return lineError(lineNum, src, ErrSyntax)
+		}
+	}
+
+	return nil
+}
+
+// nextLine returns the next line, broken into its fields,
+// ignoring comments (i.e., anything after a '#').
+func (p *parser) nextLine() (int, []string, string) {
+	line := p.lines[p.next]
+	p.next++
+
+	if idx := strings.Index(line, "#"); idx != -1 {
+		line = line[:idx]
+	}
+	line = strings.TrimSpace(line)
+
+	return p.next, strings.Fields(line), line
+}
+
+// checkName checks whether name may be used by a new function or variable.
+func (p *parser) checkName(name string) error {
+	if !isName(name) || reserved[name] || isEventField(name) {
+		return ErrSyntax
+	}
+
+	_, isFunc := p.prog.funcs[name]
+	_, isVar := p.prog.globals[name]
+	if isFunc || isVar {
+		return ErrRedefined
+	}
+
+	return nil
+}
+
+// parseBlock parses statements until the line that ends the block
+// (i.e., "end", "else" or "elif"), whose first word is returned alongside the block.
+// That line is left to be parsed by the caller.
+// If the script ends before the block, an empty word is returned.
+func (p *parser) parseBlock() ([]statement, string, error) {
+	var block []statement
+
+	for p.next < len(p.lines) {
+		lineNum, fields, src := p.nextLine()
+		if len(fields) == 0 {
+			continue
+		}
+		loc := location{lineNum: lineNum, src: src}
+		rest := strings.TrimSpace(strings.TrimPrefix(src, fields[0]))
+
+		switch fields[0] {
+		case "end", "else", "elif":
+			// Let the caller handle the end of the block,
+			// by parsing this line again.
+			p.next--
+			return block, fields[0], nil
+		case "if":
+			stmt, err := p.parseIf(loc, rest)
+			if err != nil {
+				return nil, "", err
+			}
+			block = append(block, stmt)
+		case "press", "release":
+			if len(fields) != 2 {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			}
+			keyCodes, err := p.prog.keyList(fields[1])
+			if err != nil {
+				return nil, "", lineError(lineNum, fields[1], err)
+			}
+
+			block = append(block, &keysStmt{loc, fields[0] == "press", keyCodes})
+		case "tap":
+			if len(fields) < 3 {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			}
+			keyCodes, err := p.prog.keyList(fields[1])
+			if err != nil {
+				return nil, "", lineError(lineNum, fields[1], err)
+			}
+			releaseTime, err := p.parseExpr(lineNum, strings.TrimSpace(strings.TrimPrefix(rest, fields[1])))
+			if err != nil {
+				return nil, "", err
+			}
+
+			block = append(block, &tapStmt{loc, keyCodes, releaseTime})
+		case "after":
+			if len(fields) < 3 {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			}
+			delay, err := p.parseExpr(lineNum, strings.TrimSpace(strings.TrimPrefix(rest, fields[1])))
+			if err != nil {
+				return nil, "", err
+			}
+
+			p.called[lineNum] = fields[1]
+			block = append(block, &afterStmt{loc, fields[1], delay})
+		case "call":
+			if len(fields) != 2 {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			}
+
+			p.called[lineNum] = fields[1]
+			block = append(block, &callStmt{loc, fields[1]})
+		case "use":
+			if len(fields) != 2 {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			}
+
+			block = append(block, &useStmt{loc, fields[1]})
+		case "return":
+			if len(fields) != 1 {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			}
+
+			block = append(block, &returnStmt{loc})
+		default:
+			// Anything else must be an assignment, as "NAME = EXPR".
+			if len(fields) < 3 || fields[1] != "=" {
+				return nil, "", lineError(lineNum, src, ErrSyntax)
+			} else if _, ok := p.prog.globals[fields[0]]; !ok {
+				return nil, "", lineError(lineNum, fields[0], ErrUnknownVariable)
+			}
+			value, err := p.parseExpr(lineNum, strings.TrimSpace(strings.TrimPrefix(rest, "=")))
+			if err != nil {
+				return nil, "", err
+			}
+
+			block = append(block, &assignStmt{loc, fields[0], value})
+		}
+	}
+
+	// The script ended before the block.
+	return block, "", nil
+}
+
+// parseIf parses an "if" statement, whose condition is cond,
+// alongside its "elif" and "else" blocks, up to its "end".
+func (p *parser) parseIf(loc location, cond string) (*ifStmt, error) {
+	stmt := &ifStmt{location: loc}
+	isElse := false
+
+	for {
+		var e expr
+		if !isElse {
+			var err error
+			e, err = p.parseExpr(loc.lineNum, cond)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		block, end, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		} else if end == "" || (isElse && end != "end") {
+			// The block must be closed, and nothing may follow the "else" block.
+			return nil, lineError(loc.lineNum, loc.src, ErrSyntax)
+		}
+
+		if isElse {
+			stmt.elseBlock = block
+		} else {
+			stmt.conds = append(stmt.conds, e)
+			stmt.blocks = append(stmt.blocks, block)
+		}
+
+		lineNum, fields, src := p.nextLine()
+		loc = location{lineNum: lineNum, src: src}
+		switch end {
+		case "elif":
+			cond = strings.TrimSpace(strings.TrimPrefix(src, "elif"))
+		case "else":
+			if len(fields) != 1 {
+				return nil, lineError(lineNum, src, ErrSyntax)
+			}
+			isElse = true
+		default:
+			if len(fields) != 1 {
+				return nil, lineError(lineNum, src, ErrSyntax)
+			}
+			return stmt, nil
+		}
+	}
+}
+
+// parseExpr parses an expression in the given line.
+func (p *parser) parseExpr(lineNum int, src string) (expr, error) {
+	e, err := p.prog.parseExpr(src)
+	if err != nil {
+		return nil, lineError(lineNum, src, err)
+	}
+	return e, nil
+}
@@ -0,0 +1,258 @@
+// Package script implements a small scripting language for custom MIDI actions.
+//
+// Scripts are made of functions, each called in response to a MIDI event,
+// and of integer variables, which keep their value between calls:
+//
+//	# Dash on hard hits, otherwise simply walk.
+//	var dashes = 0
+//
+//	func hit
+//	  if velocity > 100 && !held(LEFT)
+//	    tap RIGHT,X 50
+//	    dashes = dashes + 1
+//	  elif velocity > 0
+//	    press RIGHT
+//	    after stop 200
+//	  end
+//	end
+//
+//	func stop
+//	  release RIGHT
+//	end
+//
+// Every statement takes a single line:
+//   - "var NAME = VALUE": declares a variable (outside of any function);
+//   - "func NAME" ... "end": declares a function;
+//   - "if EXPR" ... ["elif EXPR" ...] ["else" ...] "end": runs statements conditionally;
+//   - "NAME = EXPR": sets a variable;
+//   - "press KEYS" / "release KEYS": presses/releases keys, separated by commas;
+//   - "tap KEYS EXPR": presses keys, releasing them after EXPR milliseconds;
+//   - "after FUNC EXPR": calls a function after EXPR milliseconds;
+//   - "call FUNC": calls a function;
+//   - "use SET": activates a named set;
+//   - "return": leaves the current function.
+//
+// Expressions work on integers, with the usual arithmetic, comparison and logical operators.
+// They may read the MIDI event's channel, note, velocity and time,
+// check whether a key is held with held(KEY),
+// and whether a named set is active with active(SET).
+//
+// Scripts are sandboxed: they may only interact with the keyboard and the named sets,
+// through a Host, and they have no loops, so every call runs for a bounded time.
+package script
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/err_wrap"
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// How many functions may be called by each other at once.
+const maxCallDepth = 16
+
+// How many statements may be executed by a single call, including nested calls.
+const maxSteps = 1000
+
+// The handle used by scripts to interact with the application.
+// Every method is called from the goroutine that called the script.
+type Host interface {
+	// PressKeys presses the requested keys, by their keycode.
+	PressKeys(keyCodes []int)
+
+	// ReleaseKeys releases the requested keys, by their keycode.
+	ReleaseKeys(keyCodes []int)
+
+	// TapKeys presses the requested keys, by their keycode,
+	// releasing them after releaseTime.
+	TapKeys(keyCodes []int, releaseTime time.Duration)
+
+	// IsKeyHeld checks whether the key, by its keycode, is currently held.
+	IsKeyHeld(keyCode int) bool
+
+	// After calls fn after delay, from the same goroutine that called the script.
+	After(delay time.Duration, fn func())
+
+	// UseSet activates the named set.
+	UseSet(name string)
+
+	// IsSetActive checks whether the named set is currently active.
+	IsSetActive(name string) bool
+}
+
+// A compiled script.
+// Programs aren't thread safe, so they must always be called from the same goroutine.
+type Program struct {
+	// The script's functions, by their names.
+	funcs map[string][]statement
+	// The current value of the script's variables.
+	globals map[string]int
+	// The initial value of the script's variables.
+	initial map[string]int
+	// Maps each key name to its keycode.
+	keys map[string]int
+}
+
+// Compile compiles the script in src.
+// Keys are resolved by their names in keys, ignoring case.
+func Compile(src string, keys map[string]int) (*Program, error) {
+	p := &Program{
+		funcs:   make(map[string][]statement),
+		globals: make(map[string]int),
+		initial: make(map[string]int),
+		keys:    keys,
+	}
+
+	// Every call to a function, by the line that called it,
+	// which are only checked once every function has been declared.
+	called := make(map[int]string)
+
+	parser := &parser{prog: p, called: called}
+	if err := parser.parse(strings.Split(src, "\n")); err != nil {
+		return nil, err
+	}
+
+	for line, name := range called {
+		if _, ok := p.funcs[name]; !ok {
+			return nil, lineError(line, name, ErrUnknownFunction)
+		}
+	}
+
+	return p, nil
+}
+
+// HasFunction checks whether the script declares the function name.
+func (p *Program) HasFunction(name string) bool {
+	_, ok := p.funcs[name]
+	return ok
+}
+
+// Reset sets every variable back to its initial value.
+func (p *Program) Reset() {
+	for name, value := range p.initial {
+		p.globals[name] = value
+	}
+}
+
+// Call calls the function name in response to the MIDI event ev.
+// Functions started later on by "after" receive the same MIDI event,
+// and their errors are logged, since they aren't returned by anyone.
+func (p *Program) Call(name string, ev midi.MidiEvent, host Host) error {
+	c := &call{
+		prog: p,
+		ev:   ev,
+		host: host,
+	}
+
+	if err := c.run(name); err != nil {
+		return err_wrap.Wrap(fmt.Errorf("calling '%s'", name), err)
+	}
+	return nil
+}
+
+// keyCode resolves the keycode of the key called name.
+func (p *Program) keyCode(name string) (int, error) {
+	keyCode, ok := p.keys[strings.ToUpper(name)]
+	if !ok || keyCode == -1 {
+		return 0, ErrUnknownKey
+	}
+
+	return keyCode, nil
+}
+
+// keyList resolves a list of key names, separated by commas, into their keycodes.
+func (p *Program) keyList(names string) ([]int, error) {
+	var keyCodes []int
+	for _, name := range strings.Split(names, ",") {
+		keyCode, err := p.keyCode(name)
+		if err != nil {
+			return nil, err
+		}
+		keyCodes = append(keyCodes, keyCode)
+	}
+
+	return keyCodes, nil
+}
+
+// lineError adds the line, and the offending token, to an error.
+func lineError(line int, token string, err error) error {
+	return err_wrap.Wrap(fmt.Errorf("line %d: '%s'", line, token), err)
+}
+
+// The state of a call to a function, and to every function it calls.
+type call struct {
+	// The program being executed.
+	prog *Program
+	// The MIDI event that started the call.
+	ev midi.MidiEvent
+	// The handle used to interact with the application.
+	host Host
+	// How many functions are currently being executed.
+	depth int
+	// How many statements have been executed.
+	steps int
+}
+
+// run executes the function name.
+func (c *call) run(name string) error {
+	if c.depth >= maxCallDepth {
+		return ErrCallDepth
+	}
+
+	c.depth++
+	_, err := c.exec(c.prog.funcs[name])
+	c.depth--
+
+	return err
+}
+
+// exec executes a block of statements,
+// returning whether the block returned early.
+func (c *call) exec(block []statement) (bool, error) {
+	for _, stmt := range block {
+		c.steps++
+		if c.steps > maxSteps {
+			return false, ErrTooManySteps
+		}
+
+		returned, err := stmt.exec(c)
+		if code, ok := err.(errCode); ok {
+			// Only errors caused directly by the statement (e.g., instead of by a function it called)
+			// are located in it.
+			return false, lineError(stmt.line(), stmt.source(), code)
+		} else if err != nil {
+			return false, err
+		} else if returned {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// after calls the function name after delay, in a new call.
+func (c *call) after(name string, delay time.Duration) {
+	prog, ev, host := c.prog, c.ev, c.host
+
+	host.After(delay, func() {
+		if err := prog.Call(name, ev, host); err != nil {
+			log.Printf("script: %+v", err)
+		}
+	})
+}
+
+// durationArg evaluates an expression as a duration, in milliseconds.
+// Negative durations are treated as zero.
+func (c *call) durationArg(e expr) (time.Duration, error) {
+	ms, err := e.eval(c)
+	if err != nil {
+		return 0, err
+	} else if ms < 0 {
+		ms = 0
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
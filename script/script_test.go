@@ -0,0 +1,214 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SirGFM/midi-go-key/midi"
+)
+
+// The keys available to the scripts in the tests.
+var testKeys = map[string]int{
+	"NONE":  -1,
+	"LEFT":  1,
+	"RIGHT": 2,
+	"X":     3,
+}
+
+// A Host that records every interaction of the script.
+type mockHost struct {
+	// Every interaction, in order.
+	calls []string
+	// The keys currently held.
+	held map[int]bool
+	// The active named set.
+	set string
+	// Functions queued by After.
+	pending []func()
+}
+
+func newMockHost() *mockHost {
+	return &mockHost{held: make(map[int]bool)}
+}
+
+func (h *mockHost) PressKeys(keyCodes []int) {
+	for _, keyCode := range keyCodes {
+		h.held[keyCode] = true
+	}
+	h.calls = append(h.calls, fmt.Sprintf("press %v", keyCodes))
+}
+
+func (h *mockHost) ReleaseKeys(keyCodes []int) {
+	for _, keyCode := range keyCodes {
+		delete(h.held, keyCode)
+	}
+	h.calls = append(h.calls, fmt.Sprintf("release %v", keyCodes))
+}
+
+func (h *mockHost) TapKeys(keyCodes []int, releaseTime time.Duration) {
+	h.calls = append(h.calls, fmt.Sprintf("tap %v %s", keyCodes, releaseTime))
+}
+
+func (h *mockHost) IsKeyHeld(keyCode int) bool {
+	return h.held[keyCode]
+}
+
+func (h *mockHost) After(delay time.Duration, fn func()) {
+	h.calls = append(h.calls, fmt.Sprintf("after %s", delay))
+	h.pending = append(h.pending, fn)
+}
+
+func (h *mockHost) UseSet(name string) {
+	h.set = name
+	h.calls = append(h.calls, "use "+name)
+}
+
+func (h *mockHost) IsSetActive(name string) bool {
+	return h.set == name
+}
+
+// assertCalls checks that the host received exactly the expected interactions,
+// and then clears them.
+func (h *mockHost) assertCalls(t *testing.T, want ...string) {
+	t.Helper()
+
+	if got := strings.Join(h.calls, "; "); got != strings.Join(want, "; ") {
+		t.Errorf("expected calls '%s', got '%s'", strings.Join(want, "; "), got)
+	}
+	h.calls = nil
+}
+
+func TestScriptCall(t *testing.T) {
+	src := `
+# Dash on hard hits, otherwise walk.
+var dashes = 0
+
+func hit
+  if velocity > 100 && !held(LEFT)
+    tap RIGHT,X 50
+    dashes = dashes + 1
+  elif velocity > 0
+    press right   # Key names ignore case.
+    after stop 100 * 2
+  else
+    return
+  end
+
+  if dashes % 2 == 0
+    use even
+  end
+end
+
+func stop
+  release RIGHT
+end
+`
+
+	prog, err := Compile(src, testKeys)
+	if err != nil {
+		t.Fatalf("failed to compile the script: %+v", err)
+	}
+	host := newMockHost()
+
+	call := func(velocity uint8) {
+		t.Helper()
+
+		ev := midi.MidiEvent{Type: midi.EventNoteOn, Key: 0x24, Velocity: velocity}
+		if err := prog.Call("hit", ev, host); err != nil {
+			t.Fatalf("failed to call the script: %+v", err)
+		}
+	}
+
+	call(120)
+	host.assertCalls(t, "tap [2 3] 50ms")
+
+	call(120)
+	host.assertCalls(t, "tap [2 3] 50ms", "use even")
+
+	call(50)
+	host.assertCalls(t, "press [2]", "after 200ms", "use even")
+
+	host.pending[0]()
+	host.assertCalls(t, "release [2]")
+
+	call(0)
+	host.assertCalls(t)
+
+	// Hard hits while holding LEFT simply walk.
+	host.held[1] = true
+	call(120)
+	host.assertCalls(t, "press [2]", "after 200ms", "use even")
+
+	// Resetting the script sets its variables back to their initial values.
+	delete(host.held, 1)
+	call(120)
+	host.assertCalls(t, "tap [2 3] 50ms")
+	prog.Reset()
+	call(120)
+	host.assertCalls(t, "tap [2 3] 50ms")
+}
+
+func TestScriptCompileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		err  error
+	}{
+		{"unknown key", "func f\npress UP\nend", ErrUnknownKey},
+		{"disabled key", "func f\npress NONE\nend", ErrUnknownKey},
+		{"unknown variable", "func f\nif count > 1\nend\nend", ErrUnknownVariable},
+		{"unknown assigned variable", "func f\ncount = 1\nend", ErrUnknownVariable},
+		{"unknown function", "func f\ncall g\nend", ErrUnknownFunction},
+		{"unknown delayed function", "func f\nafter g 10\nend", ErrUnknownFunction},
+		{"redefined function", "func f\nend\nfunc f\nend", ErrRedefined},
+		{"reserved name", "var velocity = 1", ErrSyntax},
+		{"missing end", "func f\nif 1\nend", ErrSyntax},
+		{"else outside if", "func f\nelse\nend", ErrSyntax},
+		{"statement outside function", "press LEFT", ErrSyntax},
+		{"bad expression", "func f\nif (1 +\nend\nend", ErrSyntax},
+		{"bad token", "func f\nif 1 $ 2\nend\nend", ErrSyntax},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile(tc.src, testKeys)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected error '%+v', got '%+v'", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestScriptRuntimeLimits(t *testing.T) {
+	src := `
+var zero = 0
+
+func forever
+  call forever
+end
+
+func divide
+  if 1 / zero
+  end
+end
+`
+
+	prog, err := Compile(src, testKeys)
+	if err != nil {
+		t.Fatalf("failed to compile the script: %+v", err)
+	}
+	host := newMockHost()
+
+	err = prog.Call("forever", midi.MidiEvent{}, host)
+	if !errors.Is(err, ErrCallDepth) {
+		t.Errorf("expected error '%+v', got '%+v'", ErrCallDepth, err)
+	}
+
+	err = prog.Call("divide", midi.MidiEvent{}, host)
+	if !errors.Is(err, ErrDivideByZero) {
+		t.Errorf("expected error '%+v', got '%+v'", ErrDivideByZero, err)
+	} else if !strings.Contains(err.Error(), "line 9") {
+		t.Errorf("expected the error to point to line 9, got '%+v'", err)
+	}
+}